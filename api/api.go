@@ -0,0 +1,117 @@
+// Package api holds the request and response bodies of the JSON API served
+// under /api/v1. It has no dependencies on the server, so other programs can
+// use it to talk to vote.
+package api
+
+import (
+	"time"
+
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/tally"
+)
+
+// OptionPresets are the sets of options offered when creating a poll, by name
+var OptionPresets = map[string][]string{
+	"pass-fail":             {"Pass", "Fail", "Abstain"},
+	"pass-fail-conditional": {"Pass", "Fail/Conditional", "Abstain"},
+	"fail-conditional":      {"Fail", "Conditional", "Abstain"},
+}
+
+// PollSettings are the parts of a poll its creator chooses
+type PollSettings struct {
+	ShortDescription string   `json:"shortDescription"`
+	LongDescription  string   `json:"longDescription,omitempty"`
+	VoteType         string   `json:"voteType"`
+	Options          []string `json:"options"`
+	AllowWriteIns    bool     `json:"allowWriteIns,omitempty"`
+	// TieBreak is how ties for last place are broken in a ranked or STV poll
+	TieBreak string `json:"tieBreak,omitempty"`
+	// Seats is how many options an STV poll elects
+	Seats int `json:"seats,omitempty"`
+	// MaxScore is the highest score a score or STAR ballot can give
+	MaxScore int `json:"maxScore,omitempty"`
+	// Threshold is the share of the votes the motion of a simple or approval
+	// poll needs to pass. Motion is the option it is measured on, Pass if it
+	// is left empty.
+	Threshold    string `json:"threshold,omitempty"`
+	Motion       string `json:"motion,omitempty"`
+	CountAbstain bool   `json:"countAbstain,omitempty"`
+	Quorum       int    `json:"quorum,omitempty"`
+	// QuorumPercent is the share of the voter roll, as a percentage, needed
+	// for the result to stand. The larger of it and Quorum applies.
+	QuorumPercent int `json:"quorumPercent,omitempty"`
+	// Eligibility decides who can vote, the default policy when its kind is
+	// empty
+	Eligibility eligibility.Policy `json:"eligibility"`
+	// OpensAt schedules the poll to open later, ClosesAt to close on its own
+	OpensAt  *time.Time `json:"opensAt,omitempty"`
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
+}
+
+// CreatePoll is the body of POST /api/v1/polls
+type CreatePoll struct {
+	PollSettings
+	// Draft keeps the poll unpublished, so only its creator can see it
+	Draft bool `json:"draft,omitempty"`
+}
+
+// Poll is a poll as the API shows it
+type Poll struct {
+	Id        string `json:"id"`
+	CreatedBy string `json:"createdBy"`
+	PollSettings
+	Open      bool `json:"open"`
+	Scheduled bool `json:"scheduled"`
+	Draft     bool `json:"draft"`
+	Hidden    bool `json:"hidden"`
+}
+
+// PollList is the body of GET /api/v1/polls
+type PollList struct {
+	Polls []Poll `json:"polls"`
+}
+
+// Ballot is the body of POST /api/v1/polls/{id}/ballots. Only the field for
+// the poll's vote type is read: Option for simple polls, Ranks for ranked,
+// condorcet and STV polls, Approved for approval polls, and Scores for score
+// and STAR polls. A choice that isn't one of the poll's options is a write-in.
+type Ballot struct {
+	Option   string         `json:"option,omitempty"`
+	Ranks    map[string]int `json:"ranks,omitempty"`
+	Approved []string       `json:"approved,omitempty"`
+	Scores   map[string]int `json:"scores,omitempty"`
+}
+
+// Results is the body of GET /api/v1/polls/{id}/results
+type Results struct {
+	PollId string `json:"pollId"`
+	Open   bool   `json:"open"`
+	// Voters is how many people have voted
+	Voters int           `json:"voters"`
+	Result *tally.Result `json:"result"`
+}
+
+// The kinds of events sent on the stream of a poll, /stream/{id}
+const (
+	// EventResults carries the poll's latest tally.Result whenever someone
+	// votes. It isn't sent to those who can't see the results of a hidden
+	// poll.
+	EventResults = "results"
+	// EventState carries {"open": bool} when the poll opens or closes
+	EventState = "state"
+	// EventTurnout carries a Turnout
+	EventTurnout = "turnout"
+)
+
+// Turnout is sent on the stream of a poll when someone votes, or starts or
+// stops watching it. It never says how anyone voted, so it is sent for
+// hidden polls too.
+type Turnout struct {
+	PollId string `json:"pollId"`
+	// Voted is how many people have voted
+	Voted int `json:"voted"`
+	// Eligible is the size of the poll's roll, if it has one
+	Eligible int `json:"eligible,omitempty"`
+	// Viewing is how many people have the poll open
+	Viewing int `json:"viewing"`
+}
@@ -0,0 +1,46 @@
+package api
+
+// Codes say what kind of error a request hit, each always sent with the same
+// HTTP status
+const (
+	// CodeInvalid is sent with 400 when the request body or a ballot is wrong
+	CodeInvalid = "invalid"
+	// CodeUnauthorized is sent with 401 when the request isn't logged in
+	CodeUnauthorized = "unauthorized"
+	// CodeForbidden is sent with 403 when the user isn't allowed to do this
+	CodeForbidden = "forbidden"
+	// CodeNotFound is sent with 404 when there is no such poll
+	CodeNotFound = "not_found"
+	// CodeConflict is sent with 409 when the poll isn't in a state that
+	// allows this, such as voting twice or in a closed poll
+	CodeConflict = "conflict"
+	// CodeInternal is sent with 500 when something went wrong on the server
+	CodeInternal = "internal"
+)
+
+// StatusCodes maps each HTTP status the API sends errors with to its code
+var StatusCodes = map[int]string{
+	400: CodeInvalid,
+	401: CodeUnauthorized,
+	403: CodeForbidden,
+	404: CodeNotFound,
+	409: CodeConflict,
+	500: CodeInternal,
+}
+
+// Error is what went wrong with a request
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields maps the choices of a rejected ballot to what is wrong with them
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// ErrorBody is the body of every error response
+type ErrorBody struct {
+	Error Error `json:"error"`
+}
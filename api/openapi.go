@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI document describing the API, served at
+// /api/openapi.json. Its schemas must match the types in this package.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/tally"
+)
+
+type document struct {
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	var doc document
+	if err := json.Unmarshal(OpenAPI, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	types := map[string]interface{}{
+		"CreatePoll":  CreatePoll{},
+		"Poll":        Poll{},
+		"PollList":    PollList{},
+		"Eligibility": eligibility.Policy{},
+		"Ballot":      Ballot{},
+		"Results":     Results{},
+		"Result":      tally.Result{},
+		"ErrorBody":   ErrorBody{},
+		"Error":       Error{},
+	}
+	for name, value := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		fields := jsonFields(reflect.TypeOf(value))
+		if !reflect.DeepEqual(properties, fields) {
+			t.Errorf("schema %s has properties %v, but the type has fields %v", name, properties, fields)
+		}
+	}
+}
+
+// jsonFields lists the names a struct's fields are encoded as, including the
+// fields of embedded structs
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
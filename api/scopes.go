@@ -0,0 +1,27 @@
+package api
+
+// Scopes limit what a personal API token can do. A request logged in to the
+// site can do everything.
+const (
+	// ScopePollsRead lists and gets polls
+	ScopePollsRead   = "polls:read"
+	ScopePollsCreate = "polls:create"
+	ScopePollsClose  = "polls:close"
+	// ScopePollsHide hides the results of polls, and ScopePollsReveal shows
+	// them again
+	ScopePollsHide   = "polls:hide"
+	ScopePollsReveal = "polls:reveal"
+	ScopeBallotsCast = "ballots:cast"
+	ScopeResultsRead = "results:read"
+)
+
+// Scopes lists every scope a token can have
+var Scopes = []string{
+	ScopePollsRead,
+	ScopePollsCreate,
+	ScopePollsClose,
+	ScopePollsHide,
+	ScopePollsReveal,
+	ScopeBallotsCast,
+	ScopeResultsRead,
+}
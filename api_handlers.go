@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/authz"
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// registerAPI serves the JSON API under /api/v1. It follows the same rules as
+// the pages, but answers with the types in package api, and every error with
+// an api.ErrorBody. Requests can be made with a personal API token as well as
+// the session cookie. Routes added here must also be added to
+// api/openapi.json.
+func registerAPI(r *gin.Engine, auth authenticator, broker *sse.Broker) {
+	// The document is public, so tools can read it without logging in
+	r.GET("/api/openapi.json", func(c *gin.Context) {
+		c.Data(200, "application/json", api.OpenAPI)
+	})
+
+	v1 := r.Group("/api/v1")
+
+	v1.GET("/polls", apiAuth(auth, api.ScopePollsRead, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		var polls []*database.Poll
+		var err error
+		switch state := c.DefaultQuery("state", "open"); state {
+		case "open":
+			polls, err = database.GetOpenPolls(c)
+		case "scheduled":
+			polls, err = database.GetScheduledPolls(c)
+		case "closed":
+			// Like the home page, the closed polls are the ones the user voted
+			// in or created
+			var owned []*database.Poll
+			polls, err = database.GetClosedVotedPolls(c, claims.UserInfo.Username)
+			if err == nil {
+				owned, err = database.GetClosedOwnedPolls(c, claims.UserInfo.Username)
+				polls = append(polls, owned...)
+			}
+		case "draft":
+			polls, err = database.GetDraftPolls(c, claims.UserInfo.Username)
+		default:
+			apiError(c, 400, fmt.Sprintf("Unknown state %q, it must be open, scheduled, closed or draft", state))
+			return
+		}
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		sort.Slice(polls, func(i, j int) bool {
+			return polls[i].Id > polls[j].Id
+		})
+
+		list := api.PollList{Polls: []api.Poll{}}
+		for _, poll := range uniquePolls(polls) {
+			list.Polls = append(list.Polls, apiPoll(poll))
+		}
+		c.JSON(200, list)
+	}))
+
+	v1.POST("/polls", apiAuth(auth, api.ScopePollsCreate, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+		if !can(claims, authz.Create, nil) {
+			apiError(c, 403, "You cannot create polls.")
+			return
+		}
+
+		var body api.CreatePoll
+		if err := c.ShouldBindJSON(&body); err != nil {
+			apiError(c, 400, "Invalid request body: "+err.Error())
+			return
+		}
+		if strings.TrimSpace(body.ShortDescription) == "" {
+			apiError(c, 400, "A poll needs a short description")
+			return
+		}
+		if len(body.Options) == 0 {
+			apiError(c, 400, "A poll needs at least one option")
+			return
+		}
+		for i, opt := range body.Options {
+			if strings.TrimSpace(opt) == "" {
+				apiError(c, 400, "Every option needs a name")
+				return
+			}
+			if containsString(body.Options[:i], opt) {
+				apiError(c, 400, fmt.Sprintf("%q is an option more than once", opt))
+				return
+			}
+		}
+
+		poll := &database.Poll{
+			Id:        "",
+			CreatedBy: claims.UserInfo.Username,
+			Hidden:    false,
+		}
+		if err := applyPollSettings(poll, body.PollSettings); err != nil {
+			apiError(c, 400, err.Error())
+			return
+		}
+		if body.Draft {
+			poll.Draft = true
+		} else if err := applySchedule(poll, time.Now()); err != nil {
+			apiError(c, 400, err.Error())
+			return
+		}
+		if poll.Open {
+			roll, err := takeRoll(c, poll)
+			if err != nil {
+				apiError(c, 500, err.Error())
+				return
+			}
+			poll.Roll = roll
+		}
+
+		pollId, err := database.CreatePoll(c, poll)
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		poll.Id = pollId
+		// Polls made on the site aren't recorded, but everything done with a
+		// token is
+		if requestToken(c) != nil {
+			if err := apiWriteAction(c, poll, claims, "Create Poll"); err != nil {
+				apiError(c, 500, err.Error())
+				return
+			}
+		}
+
+		c.JSON(201, apiPoll(poll))
+	}))
+
+	v1.GET("/polls/:id", apiAuth(auth, api.ScopePollsRead, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+
+		c.JSON(200, apiPoll(poll))
+	}))
+
+	v1.POST("/polls/:id/close", apiAuth(auth, api.ScopePollsClose, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+
+		if !can(claims, authz.Close, poll) {
+			apiError(c, 403, "You cannot end this poll.")
+			return
+		}
+		if poll.Draft {
+			apiError(c, 409, "A draft can't be ended, it hasn't been published.")
+			return
+		}
+		if !poll.Open && !poll.Scheduled {
+			apiError(c, 409, "This poll has already ended.")
+			return
+		}
+
+		err := poll.Close(c)
+		if errors.Is(err, database.ErrPollClosed) {
+			apiError(c, 409, "This poll has already ended.")
+			return
+		}
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		if err := apiWriteAction(c, poll, claims, "Close/End Poll"); err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		publishState(broker, poll.Id, false)
+
+		poll.Open = false
+		poll.Scheduled = false
+		c.JSON(200, apiPoll(poll))
+	}))
+
+	v1.POST("/polls/:id/hide", apiAuth(auth, api.ScopePollsHide, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+		if !can(claims, authz.Hide, poll) {
+			apiError(c, 403, "You cannot hide this poll's results.")
+			return
+		}
+
+		if err := poll.Hide(c); err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		if err := apiWriteAction(c, poll, claims, "Hide Results"); err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+
+		poll.Hidden = true
+		c.JSON(200, apiPoll(poll))
+	}))
+
+	v1.POST("/polls/:id/reveal", apiAuth(auth, api.ScopePollsReveal, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+		if !can(claims, authz.Reveal, poll) {
+			apiError(c, 403, "You cannot reveal this poll's results.")
+			return
+		}
+
+		if err := poll.Reveal(c); err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		if err := apiWriteAction(c, poll, claims, "Reveal Results"); err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+
+		poll.Hidden = false
+		c.JSON(200, apiPoll(poll))
+	}))
+
+	v1.POST("/polls/:id/ballots", apiAuth(auth, api.ScopeBallotsCast, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+		if !can(claims, authz.Vote, poll) {
+			apiError(c, 403, "You are not eligible to vote in this poll.")
+			return
+		}
+		if !poll.Open {
+			apiError(c, 409, "This poll is not open for voting.")
+			return
+		}
+
+		var ballot api.Ballot
+		if err := c.ShouldBindJSON(&ballot); err != nil {
+			apiError(c, 400, "Invalid request body: "+err.Error())
+			return
+		}
+
+		err := castBallot(c, poll, claims.UserInfo.Username, ballot)
+		var ballotErr *database.BallotError
+		if errors.As(err, &ballotErr) {
+			c.AbortWithStatusJSON(400, api.ErrorBody{Error: api.Error{
+				Code:    api.CodeInvalid,
+				Message: ballotErr.Error(),
+				Fields:  ballotErr.Fields,
+			}})
+			return
+		}
+		if errors.Is(err, database.ErrAlreadyVoted) {
+			apiError(c, 409, "You have already voted in this poll.")
+			return
+		}
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+
+		if requestToken(c) != nil {
+			if err := apiWriteAction(c, poll, claims, "Cast Ballot"); err != nil {
+				apiError(c, 500, err.Error())
+				return
+			}
+		}
+		publishResults(c, broker, poll.Id)
+		publishTurnout(c, broker, poll.Id)
+
+		c.Status(204)
+	}))
+
+	v1.GET("/polls/:id/results", apiAuth(auth, api.ScopeResultsRead, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, ok := apiFindPoll(c, claims)
+		if !ok {
+			return
+		}
+		if poll.Hidden && !can(claims, authz.ViewHidden, poll) {
+			apiError(c, 403, "The results of this poll are hidden.")
+			return
+		}
+
+		result, err := poll.GetResult(c)
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		voters, err := database.CountVoters(c, poll.Id)
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+
+		c.JSON(200, api.Results{
+			PollId: poll.Id,
+			Open:   poll.Open,
+			Voters: voters,
+			Result: result,
+		})
+	}))
+}
+
+// apiError aborts the request with an error body whose code matches status
+func apiError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, api.ErrorBody{Error: api.Error{
+		Code:    api.StatusCodes[status],
+		Message: message,
+	}})
+}
+
+// apiFindPoll looks up the poll named in the path. Drafts are only found by
+// those who can administer them. When there is no poll it responds with the error and
+// returns false.
+func apiFindPoll(c *gin.Context, claims cshAuth.CSHClaims) (*database.Poll, bool) {
+	poll, err := database.GetPoll(c, c.Param("id"))
+	if errors.Is(err, database.ErrPollNotFound) {
+		apiError(c, 404, "There is no poll with that id.")
+		return nil, false
+	}
+	if err != nil {
+		apiError(c, 500, err.Error())
+		return nil, false
+	}
+	if poll.Draft && !can(claims, authz.Administer, poll) {
+		apiError(c, 404, "There is no poll with that id.")
+		return nil, false
+	}
+	return poll, true
+}
+
+// apiWriteAction records something done to a poll through the API, and the
+// token it was done with
+func apiWriteAction(c *gin.Context, poll *database.Poll, claims cshAuth.CSHClaims, description string) error {
+	pId, _ := primitive.ObjectIDFromHex(poll.Id)
+	action := database.Action{
+		Id:     "",
+		PollId: pId,
+		Date:   primitive.NewDateTimeFromTime(time.Now()),
+		User:   claims.UserInfo.Username,
+		Action: description,
+	}
+	if token := requestToken(c); token != nil {
+		action.Token = token.Id
+	}
+	return database.WriteAction(c, &action)
+}
+
+// apiPoll is poll as the API shows it
+func apiPoll(poll *database.Poll) api.Poll {
+	return api.Poll{
+		Id:        poll.Id,
+		CreatedBy: poll.CreatedBy,
+		PollSettings: api.PollSettings{
+			ShortDescription: poll.ShortDescription,
+			LongDescription:  poll.LongDescription,
+			VoteType:         poll.VoteType,
+			Options:          poll.Options,
+			AllowWriteIns:    poll.AllowWriteIns,
+			TieBreak:         poll.TieBreak,
+			Seats:            poll.Seats,
+			MaxScore:         poll.MaxScore,
+			Threshold:        poll.Threshold,
+			Motion:           poll.Motion,
+			CountAbstain:     poll.CountAbstain,
+			Quorum:           poll.Quorum,
+			QuorumPercent:    poll.QuorumPercent,
+			Eligibility:      poll.Eligibility,
+			OpensAt:          poll.OpensAt,
+			ClosesAt:         poll.ClosesAt,
+		},
+		Open:      poll.Open,
+		Scheduled: poll.Scheduled,
+		Draft:     poll.Draft,
+		Hidden:    poll.Hidden,
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestOpenAPIRoutes checks that api/openapi.json documents exactly the routes
+// registerAPI serves
+func TestOpenAPIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAPI(r, &cshAuth.CSHAuth{}, sse.NewBroker())
+
+	var served []string
+	for _, route := range r.Routes() {
+		path, ok := strings.CutPrefix(route.Path, "/api/v1")
+		if !ok {
+			continue
+		}
+		// gin writes path parameters as :id, OpenAPI as {id}
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if name, ok := strings.CutPrefix(segment, ":"); ok {
+				segments[i] = "{" + name + "}"
+			}
+		}
+		served = append(served, route.Method+" "+strings.Join(segments, "/"))
+	}
+	sort.Strings(served)
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(api.OpenAPI, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	var documented []string
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(documented)
+
+	if strings.Join(served, "\n") != strings.Join(documented, "\n") {
+		t.Errorf("openapi.json documents\n%s\nbut the API serves\n%s", strings.Join(documented, "\n"), strings.Join(served, "\n"))
+	}
+}
+
+// TestAPIErrors runs a poll through the API, checking the status of every
+// response and that every error has the code for its status
+func TestAPIErrors(t *testing.T) {
+	r, _ := newTestServer(t)
+	chair := loggedIn(t, "chair", "active")
+	alice := loggedIn(t, "alice", "active")
+	bob := loggedIn(t, "bob", "active")
+	// Mallory isn't an active member, so can neither vote nor make polls
+	mallory := loggedIn(t, "mallory")
+	unknown := primitive.NewObjectID().Hex()
+
+	var id string
+	steps := []struct {
+		name   string
+		user   *http.Cookie
+		method string
+		// path has {id} replaced with the id of the poll made along the way
+		path   string
+		body   string
+		status int
+	}{
+		{"create without permission", mallory, "POST", "/polls", `{"shortDescription": "Budget", "voteType": "simple", "options": ["Pass", "Fail"]}`, 403},
+		{"create without options", chair, "POST", "/polls", `{"shortDescription": "Budget", "voteType": "simple"}`, 400},
+		{"create with a blank option", chair, "POST", "/polls", `{"shortDescription": "Budget", "voteType": "simple", "options": ["Pass", " "]}`, 400},
+		{"create with a duplicate option", chair, "POST", "/polls", `{"shortDescription": "Budget", "voteType": "simple", "options": ["Pass", "Pass"]}`, 400},
+		{"create with a bad body", chair, "POST", "/polls", `{"options": "Pass"}`, 400},
+		{"create", chair, "POST", "/polls", `{"shortDescription": "Budget", "voteType": "simple", "options": ["Pass", "Fail", "Abstain"]}`, 201},
+
+		{"get an unknown poll", alice, "GET", "/polls/" + unknown, "", 404},
+		{"get a malformed id", alice, "GET", "/polls/budget", "", 404},
+		{"get", alice, "GET", "/polls/{id}", "", 200},
+
+		{"cast an unknown option", alice, "POST", "/polls/{id}/ballots", `{"option": "Maybe"}`, 400},
+		{"cast a bad body", alice, "POST", "/polls/{id}/ballots", `{"option": 1}`, 400},
+		{"cast without being eligible", mallory, "POST", "/polls/{id}/ballots", `{"option": "Pass"}`, 403},
+		{"cast in an unknown poll", alice, "POST", "/polls/" + unknown + "/ballots", `{"option": "Pass"}`, 404},
+		{"cast", alice, "POST", "/polls/{id}/ballots", `{"option": "Pass"}`, 204},
+		{"cast again", alice, "POST", "/polls/{id}/ballots", `{"option": "Fail"}`, 409},
+
+		{"hide without permission", alice, "POST", "/polls/{id}/hide", "", 403},
+		{"hide", chair, "POST", "/polls/{id}/hide", "", 200},
+		{"results while hidden", alice, "GET", "/polls/{id}/results", "", 403},
+		{"results while hidden to the creator", chair, "GET", "/polls/{id}/results", "", 200},
+		{"reveal without permission", alice, "POST", "/polls/{id}/reveal", "", 403},
+		{"reveal", chair, "POST", "/polls/{id}/reveal", "", 200},
+		{"results", alice, "GET", "/polls/{id}/results", "", 200},
+		{"results of an unknown poll", alice, "GET", "/polls/" + unknown + "/results", "", 404},
+
+		{"close without permission", alice, "POST", "/polls/{id}/close", "", 403},
+		{"close an unknown poll", chair, "POST", "/polls/" + unknown + "/close", "", 404},
+		{"close", chair, "POST", "/polls/{id}/close", "", 200},
+		{"close again", chair, "POST", "/polls/{id}/close", "", 409},
+		{"cast once closed", bob, "POST", "/polls/{id}/ballots", `{"option": "Pass"}`, 409},
+	}
+	for _, step := range steps {
+		request := httptest.NewRequest(step.method, "/api/v1"+strings.ReplaceAll(step.path, "{id}", id), bytes.NewBufferString(step.body))
+		request.Header.Set("Content-Type", "application/json")
+		request.AddCookie(step.user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+
+		if w.Code != step.status {
+			t.Fatalf("%s: got %d %s, want %d", step.name, w.Code, w.Body.String(), step.status)
+		}
+		if step.status >= 400 {
+			var body api.ErrorBody
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != api.StatusCodes[step.status] || body.Error.Message == "" {
+				t.Errorf("%s: error body %s, want code %q and a message", step.name, w.Body.String(), api.StatusCodes[step.status])
+			}
+		}
+		if step.name == "create" {
+			var poll api.Poll
+			if err := json.Unmarshal(w.Body.Bytes(), &poll); err != nil || poll.Id == "" {
+				t.Fatalf("create returned %s", w.Body.String())
+			}
+			id = poll.Id
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/gin-gonic/gin"
+)
+
+// authenticator logs users in. It is *cshAuth.CSHAuth in production, and
+// devAuth when running locally without an OIDC provider.
+type authenticator interface {
+	// AuthWrapper sets the user's claims under "cshauth" before calling page,
+	// or sends them to log in
+	AuthWrapper(page gin.HandlerFunc) gin.HandlerFunc
+	AuthRequest(c *gin.Context)
+	AuthCallback(c *gin.Context)
+	AuthLogout(c *gin.Context)
+}
+
+// devGroups are offered on the development login page, since they are the
+// ones vote checks for
+var devGroups = []string{"member", "active", "active_rtp", "eboard", "10weeks", "fall_coop", "spring_coop"}
+
+// devAuth lets anyone log in as anyone, with whatever groups they like, by
+// choosing them on a login page. The user is kept in the same cookie the
+// real login uses, unsigned, so it must never be used in production.
+type devAuth struct{}
+
+func (devAuth) AuthWrapper(page gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, err := c.Cookie(cshAuth.CookieName)
+		var info cshAuth.CSHUserInfo
+		if err == nil {
+			err = decodeDevUser(cookie, &info)
+		}
+		if err != nil || info.Username == "" {
+			c.Redirect(http.StatusFound, "/auth/login?referer="+url.QueryEscape(c.Request.URL.String()))
+			return
+		}
+
+		c.Set(cshAuth.AuthKey, cshAuth.CSHClaims{UserInfo: info})
+		page(c)
+	}
+}
+
+// AuthRequest shows the login page, and logs in the user it posts
+func (devAuth) AuthRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.HTML(200, "dev_login.tmpl", gin.H{
+			"Referer": c.Query("referer"),
+			"Groups":  devGroups,
+		})
+		return
+	}
+
+	username := strings.TrimSpace(c.PostForm("username"))
+	if username == "" {
+		c.HTML(400, "dev_login.tmpl", gin.H{
+			"Referer": c.PostForm("referer"),
+			"Groups":  devGroups,
+			"Error":   "Choose a username to log in as.",
+		})
+		return
+	}
+	groups := c.PostFormArray("group")
+	for _, group := range strings.Split(c.PostForm("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" && !containsString(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	fullName := strings.TrimSpace(c.PostForm("fullName"))
+	if fullName == "" {
+		fullName = username
+	}
+
+	cookie, err := encodeDevUser(cshAuth.CSHUserInfo{
+		Username: username,
+		FullName: fullName,
+		Groups:   groups,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.SetCookie(cshAuth.CookieName, cookie, 0, "/", "", false, true)
+	c.Redirect(http.StatusFound, localReferer(c.PostForm("referer")))
+}
+
+// AuthCallback has nothing to do, since there is no provider to return from
+func (devAuth) AuthCallback(c *gin.Context) {
+	c.Redirect(http.StatusFound, localReferer(c.Query("referer")))
+}
+
+func (devAuth) AuthLogout(c *gin.Context) {
+	c.SetCookie(cshAuth.CookieName, "", -1, "/", "", false, true)
+	c.Redirect(http.StatusFound, "/auth/login")
+}
+
+func encodeDevUser(info cshAuth.CSHUserInfo) (string, error) {
+	bytes, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func decodeDevUser(cookie string, info *cshAuth.CSHUserInfo) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, info)
+}
+
+// localReferer is where to go after logging in, which is only ever a page of
+// this site
+func localReferer(referer string) string {
+	if !strings.HasPrefix(referer, "/") || strings.HasPrefix(referer, "//") || strings.HasPrefix(referer, "/\\") {
+		return "/"
+	}
+	return referer
+}
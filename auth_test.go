@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/gin-gonic/gin"
+)
+
+// TestDevAuth logs in on the development login page and checks the claims
+// handlers see afterwards
+func TestDevAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	auth := devAuth{}
+	r.POST("/auth/login", auth.AuthRequest)
+	r.GET("/whoami", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+		c.JSON(200, claims.UserInfo)
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/whoami?x=1", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/auth/login?referer="+url.QueryEscape("/whoami?x=1") {
+		t.Fatalf("logged out request got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	form := url.Values{
+		"username": {"alice"},
+		"group":    {"active", "eboard"},
+		"groups":   {"rtp, eboard"},
+		"referer":  {"/whoami?x=1"},
+	}
+	request := httptest.NewRequest("POST", "/auth/login", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/whoami?x=1" {
+		t.Fatalf("login got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cshAuth.CookieName {
+		t.Fatalf("login set cookies %v", cookies)
+	}
+
+	request = httptest.NewRequest("GET", "/whoami", nil)
+	request.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	if w.Code != 200 {
+		t.Fatalf("logged in request got %d", w.Code)
+	}
+	var info cshAuth.CSHUserInfo
+	if err := decodeDevUser(cookies[0].Value, &info); err != nil {
+		t.Fatal(err)
+	}
+	want := cshAuth.CSHUserInfo{Username: "alice", FullName: "alice", Groups: []string{"active", "eboard", "rtp"}}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("logged in as %+v, want %+v", info, want)
+	}
+	if !strings.Contains(w.Body.String(), `"preferred_username":"alice"`) {
+		t.Errorf("handler saw %s", w.Body.String())
+	}
+}
+
+func TestLocalReferer(t *testing.T) {
+	for referer, want := range map[string]string{
+		"/poll/1":             "/poll/1",
+		"":                    "/",
+		"https://example.com": "/",
+		"//example.com":       "/",
+		"/\\example.com":      "/",
+	} {
+		if got := localReferer(referer); got != want {
+			t.Errorf("localReferer(%q) = %q, want %q", referer, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package authz decides what users can do. Each Permission is granted to a
+// list of roles, and users have roles through their groups, or through
+// their relation to the poll they are acting on.
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Permission string
+
+const (
+	// Create is creating polls
+	Create Permission = "create"
+	// Vote is voting in a poll
+	Vote Permission = "vote"
+	// Close is ending a poll early
+	Close Permission = "close"
+	// Hide is hiding a poll's results
+	Hide Permission = "hide"
+	// Reveal is showing a poll's hidden results again
+	Reveal Permission = "reveal"
+	// ViewHidden is seeing a poll's results while they are hidden
+	ViewHidden Permission = "view-hidden"
+	// Administer is managing a poll: seeing and editing it as a draft,
+	// publishing it, breaking its ties and seeing who hasn't voted
+	Administer Permission = "administer"
+)
+
+// Permissions lists every permission
+var Permissions = []Permission{Create, Vote, Close, Hide, Reveal, ViewHidden, Administer}
+
+// Built-in roles are had by relation rather than by group
+const (
+	// RoleEveryone is had by every user
+	RoleEveryone = "everyone"
+	// RoleCreator is had by the user who created the poll
+	RoleCreator = "creator"
+	// RoleEligible is had by users eligible to vote in the poll, or under the
+	// default policy when there is no poll
+	RoleEligible = "eligible"
+)
+
+// Config maps groups to roles, and roles to permissions
+type Config struct {
+	// Roles lists the groups whose members have each role
+	Roles map[string][]string `json:"roles"`
+	// Permissions lists the roles that have each permission
+	Permissions map[Permission][]string `json:"permissions"`
+}
+
+// DefaultConfig is how vote has always worked: eligible members create polls
+// and vote, and only a poll's creator manages it, except that RTPs and
+// eboard can end any poll.
+func DefaultConfig() Config {
+	return Config{
+		Roles: map[string][]string{
+			"admin": {"active_rtp", "eboard"},
+		},
+		Permissions: map[Permission][]string{
+			Create:     {RoleEligible},
+			Vote:       {RoleEligible},
+			Close:      {RoleCreator, "admin"},
+			Hide:       {RoleCreator},
+			Reveal:     {RoleCreator},
+			ViewHidden: {RoleCreator},
+			Administer: {RoleCreator},
+		},
+	}
+}
+
+// LoadConfig reads a JSON config from path. Roles and permissions it leaves
+// out keep their defaults.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	var file Config
+	if err := json.Unmarshal(data, &file); err != nil {
+		return config, err
+	}
+	for role, groups := range file.Roles {
+		config.Roles[role] = groups
+	}
+	for permission, roles := range file.Permissions {
+		config.Permissions[permission] = roles
+	}
+	return config, config.Validate()
+}
+
+// Validate checks that the config only names known permissions, and roles
+// that are either built in or given groups
+func (config Config) Validate() error {
+	for permission, roles := range config.Permissions {
+		if !contains(Permissions, permission) {
+			return fmt.Errorf("unknown permission %q", permission)
+		}
+		for _, role := range roles {
+			if _, ok := config.Roles[role]; !ok && role != RoleEveryone && role != RoleCreator && role != RoleEligible {
+				return fmt.Errorf("permission %q is given to unknown role %q", permission, role)
+			}
+		}
+	}
+	return nil
+}
+
+// User is who is asking
+type User struct {
+	Username string
+	Groups   []string
+}
+
+// Poll is what is known about the poll a user is acting on. The zero Poll is
+// for actions that aren't on a poll, like creating one.
+type Poll struct {
+	CreatedBy string
+	// Eligible is whether the user can vote in the poll
+	Eligible bool
+}
+
+// Authorizer answers whether users have permissions under a Config
+type Authorizer struct {
+	config Config
+}
+
+func New(config Config) *Authorizer {
+	return &Authorizer{config: config}
+}
+
+// Roles lists the roles the user has when acting on poll
+func (authorizer *Authorizer) Roles(user User, poll Poll) []string {
+	roles := []string{RoleEveryone}
+	if poll.CreatedBy != "" && poll.CreatedBy == user.Username {
+		roles = append(roles, RoleCreator)
+	}
+	if poll.Eligible {
+		roles = append(roles, RoleEligible)
+	}
+	for role, groups := range authorizer.config.Roles {
+		for _, group := range user.Groups {
+			if contains(groups, group) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// Can reports whether the user has permission when acting on poll
+func (authorizer *Authorizer) Can(user User, permission Permission, poll Poll) bool {
+	return authorizer.Grants(user, poll).Has(permission)
+}
+
+// Grants lists every permission the user has when acting on poll
+func (authorizer *Authorizer) Grants(user User, poll Poll) Grants {
+	roles := authorizer.Roles(user, poll)
+	grants := make(Grants)
+	for permission, allowed := range authorizer.config.Permissions {
+		for _, role := range roles {
+			if contains(allowed, role) {
+				grants[permission] = true
+				break
+			}
+		}
+	}
+	return grants
+}
+
+// Grants is a set of permissions. Templates can check one with
+// {{ if .Can.Has "close" }}.
+type Grants map[Permission]bool
+
+func (grants Grants) Has(permission Permission) bool {
+	return grants[permission]
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
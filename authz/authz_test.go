@@ -0,0 +1,87 @@
+package authz
+
+import (
+	"testing"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	authorizer := New(DefaultConfig())
+	poll := Poll{CreatedBy: "alice", Eligible: true}
+	alice := User{"alice", []string{"active"}}
+	bob := User{"bob", []string{"active"}}
+	rtp := User{"carol", []string{"active_rtp"}}
+
+	tests := []struct {
+		name       string
+		user       User
+		permission Permission
+		poll       Poll
+		want       bool
+	}{
+		{"eligible can create", bob, Create, Poll{Eligible: true}, true},
+		{"ineligible can't create", bob, Create, Poll{}, false},
+		{"eligible can vote", bob, Vote, poll, true},
+		{"ineligible creator can't vote", alice, Vote, Poll{CreatedBy: "alice"}, false},
+		{"creator can close", alice, Close, poll, true},
+		{"RTP can close", rtp, Close, poll, true},
+		{"others can't close", bob, Close, poll, false},
+		{"creator can hide", alice, Hide, poll, true},
+		{"RTP can't hide", rtp, Hide, poll, false},
+		{"creator can reveal", alice, Reveal, poll, true},
+		{"creator can view hidden", alice, ViewHidden, poll, true},
+		{"others can't view hidden", bob, ViewHidden, poll, false},
+		{"creator can administer", alice, Administer, poll, true},
+		{"RTP can't administer", rtp, Administer, poll, false},
+		{"nobody administers a poll without a creator", User{}, Administer, Poll{}, false},
+	}
+	for _, test := range tests {
+		if got := authorizer.Can(test.user, test.permission, test.poll); got != test.want {
+			t.Errorf("%s: Can(%v, %q) = %v, want %v", test.name, test.user, test.permission, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig("testdata/authz.json")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	authorizer := New(config)
+	poll := Poll{CreatedBy: "alice"}
+
+	evals := User{"dave", []string{"eval_director"}}
+	if !authorizer.Can(evals, ViewHidden, poll) {
+		t.Errorf("a new role should be given its permissions")
+	}
+	if authorizer.Can(evals, Close, poll) {
+		t.Errorf("a new role shouldn't get permissions it wasn't given")
+	}
+	rtp := User{"carol", []string{"active_rtp"}}
+	if !authorizer.Can(rtp, Administer, poll) {
+		t.Errorf("a changed permission should use its new roles")
+	}
+	if !authorizer.Can(rtp, Close, poll) {
+		t.Errorf("permissions left out should keep their defaults")
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	if _, err := LoadConfig("testdata/unknown.json"); err == nil {
+		t.Errorf("LoadConfig() of an unknown permission should fail")
+	}
+	if _, err := LoadConfig("testdata/missing.json"); err == nil {
+		t.Errorf("LoadConfig() of a missing file should fail")
+	}
+	config := DefaultConfig()
+	config.Permissions[Close] = []string{"nobody"}
+	if err := config.Validate(); err == nil {
+		t.Errorf("Validate() with an unknown role should fail")
+	}
+}
+
+func TestGrants(t *testing.T) {
+	grants := New(DefaultConfig()).Grants(User{"alice", nil}, Poll{CreatedBy: "alice"})
+	if !grants.Has(Hide) || grants.Has(Vote) {
+		t.Errorf("Grants() = %v", grants)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// castBallot checks ballot against the poll and casts it for username. It
+// returns a *database.BallotError when the ballot is invalid, and
+// database.ErrAlreadyVoted when the user has already voted.
+func castBallot(ctx context.Context, poll *database.Poll, username string, ballot api.Ballot) error {
+	pId, err := primitive.ObjectIDFromHex(poll.Id)
+	if err != nil {
+		return err
+	}
+	voter := database.Voter{
+		PollId: pId,
+		UserId: username,
+	}
+
+	switch {
+	case poll.VoteType == database.POLL_TYPE_SIMPLE:
+		option, err := poll.NormalizeOption(ballot.Option)
+		if err != nil {
+			return err
+		}
+		vote := database.SimpleVote{
+			Id:     "",
+			PollId: pId,
+			Option: option,
+		}
+		return database.CastSimpleVote(ctx, &vote, &voter)
+
+	case poll.IsRanked():
+		ranks, err := poll.NormalizeRanks(ballot.Ranks)
+		if err != nil {
+			return err
+		}
+		vote := database.RankedVote{
+			Id:      "",
+			PollId:  pId,
+			Options: ranks,
+		}
+		return database.CastRankedVote(ctx, &vote, &voter)
+
+	case poll.VoteType == database.POLL_TYPE_APPROVAL:
+		approved, err := poll.NormalizeApprovals(ballot.Approved)
+		if err != nil {
+			return err
+		}
+		vote := database.ApprovalVote{
+			Id:      "",
+			PollId:  pId,
+			Options: approved,
+		}
+		return database.CastApprovalVote(ctx, &vote, &voter)
+
+	case poll.VoteType == database.POLL_TYPE_SCORE || poll.VoteType == database.POLL_TYPE_STAR:
+		scores, err := poll.NormalizeScores(ballot.Scores)
+		if err != nil {
+			return err
+		}
+		vote := database.ScoreVote{
+			Id:     "",
+			PollId: pId,
+			Scores: scores,
+		}
+		return database.CastScoreVote(ctx, &vote, &voter)
+	}
+
+	return fmt.Errorf("unknown poll type %q", poll.VoteType)
+}
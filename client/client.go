@@ -0,0 +1,223 @@
+// Package client talks to the vote JSON API, described by api/openapi.json,
+// so other Go programs can create polls, vote and read results.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/computersciencehouse/vote/api"
+)
+
+// Client is a client of the API of the vote server at BaseURL
+type Client struct {
+	// BaseURL is where the server is, like https://vote.csh.rit.edu
+	BaseURL string
+	// AuthCookie is the session cookie set when logging in to the site
+	AuthCookie string
+	// Token is a personal API token, used instead of AuthCookie when set
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the server at baseURL, logged in with authCookie
+func New(baseURL, authCookie string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		AuthCookie: authCookie,
+		HTTPClient: &http.Client{
+			// The server redirects requests that aren't logged in to the login
+			// page, which is an error here rather than something to follow
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// NewWithToken returns a Client for the server at baseURL, using a personal
+// API token
+func NewWithToken(baseURL, token string) *Client {
+	client := New(baseURL, "")
+	client.Token = token
+	return client
+}
+
+// ListPolls returns the polls in state, which is one of open, scheduled,
+// closed or draft
+func (client *Client) ListPolls(ctx context.Context, state string) ([]api.Poll, error) {
+	var list api.PollList
+	err := client.do(ctx, "GET", "/polls?state="+url.QueryEscape(state), nil, &list)
+	return list.Polls, err
+}
+
+func (client *Client) CreatePoll(ctx context.Context, poll api.CreatePoll) (*api.Poll, error) {
+	var created api.Poll
+	if err := client.do(ctx, "POST", "/polls", poll, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (client *Client) GetPoll(ctx context.Context, id string) (*api.Poll, error) {
+	return client.pollRequest(ctx, "GET", id, "")
+}
+
+// ClosePoll ends voting in a poll
+func (client *Client) ClosePoll(ctx context.Context, id string) (*api.Poll, error) {
+	return client.pollRequest(ctx, "POST", id, "/close")
+}
+
+// HidePoll hides a poll's results from everyone but its creator
+func (client *Client) HidePoll(ctx context.Context, id string) (*api.Poll, error) {
+	return client.pollRequest(ctx, "POST", id, "/hide")
+}
+
+// RevealPoll shows a poll's results to everyone
+func (client *Client) RevealPoll(ctx context.Context, id string) (*api.Poll, error) {
+	return client.pollRequest(ctx, "POST", id, "/reveal")
+}
+
+// CastBallot votes in a poll. A ballot the poll rejects returns an *api.Error
+// whose Fields say what is wrong with each choice.
+func (client *Client) CastBallot(ctx context.Context, id string, ballot api.Ballot) error {
+	return client.do(ctx, "POST", "/polls/"+url.PathEscape(id)+"/ballots", ballot, nil)
+}
+
+func (client *Client) GetResults(ctx context.Context, id string) (*api.Results, error) {
+	var results api.Results
+	if err := client.do(ctx, "GET", "/polls/"+url.PathEscape(id)+"/results", nil, &results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+func (client *Client) pollRequest(ctx context.Context, method, id, action string) (*api.Poll, error) {
+	var poll api.Poll
+	if err := client.do(ctx, method, "/polls/"+url.PathEscape(id)+action, nil, &poll); err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// Stream calls handle with the kind and data of each event sent about a poll,
+// until ctx is done, the server hangs up, or handle returns an error, which
+// Stream returns. The kinds are api.EventResults, api.EventState and
+// api.EventTurnout. Other events, like the one telling clients to reconnect
+// when the server shuts down, are skipped.
+func (client *Client) Stream(ctx context.Context, pollId string, handle func(event string, data []byte) error) error {
+	req, err := client.newRequest(ctx, "GET", "/stream/"+url.PathEscape(pollId), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var name string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line ends an event
+			if data != nil && (name == api.EventResults || name == api.EventState || name == api.EventTurnout) {
+				if err := handle(name, data); err != nil {
+					return err
+				}
+			}
+			name, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(strings.TrimPrefix(line, "event:"), " ")
+		case strings.HasPrefix(line, "data:"):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// do sends body as JSON to path under /api/v1, and decodes the response into
+// out. An error response from the server is returned as an *api.Error.
+func (client *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := client.newRequest(ctx, method, "/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newRequest makes a request to path on the server, logged in as the client
+func (client *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, client.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if client.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.Token)
+	} else if client.AuthCookie != "" {
+		req.AddCookie(&http.Cookie{Name: "Auth", Value: client.AuthCookie})
+	}
+	return req, nil
+}
+
+// responseError is the error the server responded with. The server redirects
+// requests that aren't logged in to the login page, which is reported as
+// unauthorized.
+func responseError(resp *http.Response) error {
+	var errBody api.ErrorBody
+	if err := json.NewDecoder(resp.Body).Decode(&errBody); err != nil || errBody.Error.Code == "" {
+		if resp.StatusCode < 400 {
+			return &api.Error{Code: api.CodeUnauthorized, Message: "not logged in"}
+		}
+		return fmt.Errorf("vote: unexpected response %s", resp.Status)
+	}
+	return &errBody.Error
+}
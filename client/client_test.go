@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/computersciencehouse/vote/api"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token" {
+			// A token logs in as well as the session cookie
+		} else if cookie, err := r.Cookie("Auth"); err != nil || cookie.Value != "session" {
+			http.Redirect(w, r, "/auth/login", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/polls":
+			if r.URL.Query().Get("state") != "closed" {
+				t.Errorf("state = %q, want closed", r.URL.Query().Get("state"))
+			}
+			json.NewEncoder(w).Encode(api.PollList{Polls: []api.Poll{{Id: "1"}, {Id: "2"}}})
+		case "POST /api/v1/polls":
+			var body api.CreatePoll
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(api.Poll{Id: "3", PollSettings: body.PollSettings, Open: true})
+		case "POST /api/v1/polls/3/close":
+			json.NewEncoder(w).Encode(api.Poll{Id: "3"})
+		case "POST /api/v1/polls/3/ballots":
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(api.ErrorBody{Error: api.Error{
+				Code:    api.CodeInvalid,
+				Message: "ballot has invalid choices",
+				Fields:  map[string]string{"Pizza": "Rank must be between 1 and 2"},
+			}})
+		case "POST /api/v1/polls/4/ballots":
+			w.WriteHeader(204)
+		default:
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(api.ErrorBody{Error: api.Error{Code: api.CodeNotFound, Message: "There is no poll with that id."}})
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL+"/", "session")
+
+	polls, err := client.ListPolls(ctx, "closed")
+	if err != nil || len(polls) != 2 {
+		t.Fatalf("ListPolls = %v, %v, want 2 polls", polls, err)
+	}
+
+	poll, err := client.CreatePoll(ctx, api.CreatePoll{PollSettings: api.PollSettings{
+		ShortDescription: "Lunch",
+		Options:          []string{"Pizza", "Tacos"},
+	}})
+	if err != nil || poll.Id != "3" || poll.ShortDescription != "Lunch" || !poll.Open {
+		t.Fatalf("CreatePoll = %+v, %v", poll, err)
+	}
+
+	poll, err = client.ClosePoll(ctx, "3")
+	if err != nil || poll.Open {
+		t.Fatalf("ClosePoll = %+v, %v", poll, err)
+	}
+
+	if err := client.CastBallot(ctx, "4", api.Ballot{Option: "Pizza"}); err != nil {
+		t.Fatalf("CastBallot = %v", err)
+	}
+
+	var apiErr *api.Error
+	err = client.CastBallot(ctx, "3", api.Ballot{Ranks: map[string]int{"Pizza": 3}})
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeInvalid || apiErr.Fields["Pizza"] == "" {
+		t.Fatalf("CastBallot of an invalid ballot = %v, want an invalid error with fields", err)
+	}
+
+	_, err = client.GetResults(ctx, "5")
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeNotFound {
+		t.Fatalf("GetResults of a missing poll = %v, want not_found", err)
+	}
+
+	if _, err := NewWithToken(server.URL, "token").ClosePoll(ctx, "3"); err != nil {
+		t.Fatalf("ClosePoll with a token = %v", err)
+	}
+
+	_, err = New(server.URL, "").GetPoll(ctx, "3")
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeUnauthorized {
+		t.Fatalf("GetPoll without logging in = %v, want unauthorized", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stream/3" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "retry:3000\n\n")
+		io.WriteString(w, "id:1\nevent:state\ndata:{\"open\":true}\n\n")
+		io.WriteString(w, ": heartbeat\n\n")
+		io.WriteString(w, "event:reconnect\ndata:The server is restarting\n\n")
+		io.WriteString(w, "event:results\ndata:first\ndata:second\n\n")
+		io.WriteString(w, "event:turnout\ndata:ignored\n\n")
+	}))
+	defer server.Close()
+
+	stop := errors.New("stop")
+	var events []string
+	err := NewWithToken(server.URL, "token").Stream(context.Background(), "3", func(event string, data []byte) error {
+		events = append(events, event+" "+string(data))
+		if len(events) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Stream = %v, want the handler's error", err)
+	}
+	want := []string{`state {"open":true}`, "results first\nsecond"}
+	if len(events) != 2 || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+}
@@ -0,0 +1,408 @@
+// Command votectl runs votes from a terminal, through the vote API.
+//
+//	votectl [-url URL] [-token TOKEN] [-json] <command> [arguments]
+//
+// The server and login default to $VOTE_URL, and $VOTE_TOKEN, a personal API
+// token made at /tokens, or $VOTE_COOKIE, the site's session cookie.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/client"
+	"github.com/computersciencehouse/vote/eligibility"
+)
+
+const usage = `usage: votectl [-url URL] [-token TOKEN] [-cookie COOKIE] [-json] <command> [arguments]
+
+commands:
+  list [-state open|scheduled|closed|draft]   list polls
+  show <id>                                   show a poll
+  create -title TITLE [flags]                 create a poll, see votectl create -h
+  vote <id> <choice>...                       vote in a poll
+  close <id>                                  end a poll
+  hide <id>                                   hide a poll's results
+  reveal <id>                                 reveal a poll's results
+  results <id>                                show a poll's results
+  watch <id>                                  show a poll's results as votes come in
+
+A vote lists one choice in a simple poll, the choices in order of preference
+in a ranked, condorcet or STV poll, every approved choice in an approval poll,
+and choice=score pairs in a score or STAR poll. Any choice that isn't an
+option is a write-in.
+`
+
+// cli is the state shared by every command
+type cli struct {
+	client *client.Client
+	json   bool
+	out    io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("votectl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	url := flags.String("url", envOr("VOTE_URL", "http://localhost:8080"), "the vote server")
+	token := flags.String("token", os.Getenv("VOTE_TOKEN"), "a personal API token")
+	cookie := flags.String("cookie", os.Getenv("VOTE_COOKIE"), "the site's session cookie, used if there is no token")
+	asJSON := flags.Bool("json", false, "print JSON instead of tables")
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := &cli{client: client.New(*url, *cookie), json: *asJSON, out: os.Stdout}
+	c.client.Token = *token
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := c.run(ctx, flags.Arg(0), flags.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "votectl:", err)
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) {
+			for choice, problem := range apiErr.Fields {
+				fmt.Fprintf(os.Stderr, "  %s: %s\n", choice, problem)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+func (c *cli) run(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ExitOnError)
+		state := flags.String("state", "open", "which polls to list: open, scheduled, closed or draft")
+		flags.Parse(args)
+		polls, err := c.client.ListPolls(ctx, *state)
+		if err != nil {
+			return err
+		}
+		return c.print(polls, func(w io.Writer) { printPolls(w, polls) })
+
+	case "show":
+		id, err := onlyArg(command, args)
+		if err != nil {
+			return err
+		}
+		poll, err := c.client.GetPoll(ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.print(poll, func(w io.Writer) { printPoll(w, poll) })
+
+	case "create":
+		create, err := parseCreate(args)
+		if err != nil {
+			return err
+		}
+		poll, err := c.client.CreatePoll(ctx, create)
+		if err != nil {
+			return err
+		}
+		return c.print(poll, func(w io.Writer) { printPoll(w, poll) })
+
+	case "vote":
+		if len(args) < 2 {
+			return errors.New("usage: votectl vote <id> <choice>...")
+		}
+		poll, err := c.client.GetPoll(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		ballot, err := ballotFor(poll.VoteType, args[1:])
+		if err != nil {
+			return err
+		}
+		if err := c.client.CastBallot(ctx, poll.Id, ballot); err != nil {
+			return err
+		}
+		if !c.json {
+			fmt.Fprintln(c.out, "Your vote was cast.")
+		}
+		return nil
+
+	case "close", "hide", "reveal":
+		id, err := onlyArg(command, args)
+		if err != nil {
+			return err
+		}
+		change := map[string]func(context.Context, string) (*api.Poll, error){
+			"close":  c.client.ClosePoll,
+			"hide":   c.client.HidePoll,
+			"reveal": c.client.RevealPoll,
+		}[command]
+		poll, err := change(ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.print(poll, func(w io.Writer) { printPoll(w, poll) })
+
+	case "results":
+		id, err := onlyArg(command, args)
+		if err != nil {
+			return err
+		}
+		results, err := c.client.GetResults(ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.print(results, func(w io.Writer) { printResults(w, results) })
+
+	case "watch":
+		id, err := onlyArg(command, args)
+		if err != nil {
+			return err
+		}
+		return c.watch(ctx, id)
+	}
+
+	return fmt.Errorf("unknown command %q, run votectl -h for help", command)
+}
+
+// watch prints the results of a poll, and again every time they change,
+// until the poll closes
+func (c *cli) watch(ctx context.Context, id string) error {
+	results, err := c.client.GetResults(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.print(results, func(w io.Writer) { printResults(w, results) }); err != nil {
+		return err
+	}
+	if !results.Open {
+		return nil
+	}
+
+	closed := errors.New("closed")
+	err = c.client.Stream(ctx, id, func(event string, data []byte) error {
+		switch event {
+		case api.EventState:
+			// Stop watching once the poll closes
+			var state struct {
+				Open bool `json:"open"`
+			}
+			if json.Unmarshal(data, &state) == nil && !state.Open {
+				return closed
+			}
+		case api.EventResults:
+			// The stream carries the count but not how many voted, so both
+			// are fetched again
+			results, err := c.client.GetResults(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !c.json {
+				fmt.Fprintf(c.out, "\n--- %s ---\n", time.Now().Format("15:04:05"))
+			}
+			return c.print(results, func(w io.Writer) { printResults(w, results) })
+		}
+		return nil
+	})
+	if errors.Is(err, closed) {
+		if !c.json {
+			fmt.Fprintln(c.out, "\nThe poll has closed.")
+		}
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// print writes value as JSON with -json, or else with table
+func (c *cli) print(value interface{}, table func(w io.Writer)) error {
+	if c.json {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	table(c.out)
+	return nil
+}
+
+// parseCreate reads the flags of the create command
+func parseCreate(args []string) (api.CreatePoll, error) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	title := flags.String("title", "", "the short description of the poll")
+	description := flags.String("description", "", "the long description of the poll")
+	voteType := flags.String("type", "simple", "simple, ranked, condorcet, stv, approval, score or star")
+	preset := flags.String("preset", "pass-fail", "the options: pass-fail, pass-fail-conditional or fail-conditional")
+	options := flags.String("options", "", "comma-separated options, instead of a preset")
+	writeIns := flags.Bool("writeins", false, "allow write-ins")
+	seats := flags.Int("seats", 1, "how many options an STV poll elects")
+	maxScore := flags.Int("max-score", 5, "the highest score in a score or STAR poll")
+	tieBreak := flags.String("tie-break", "", "previous-round, random or creator, for ranked and STV polls")
+	threshold := flags.String("threshold", "", "majority, two-thirds, three-quarters or unanimous, for simple and approval polls")
+	motion := flags.String("motion", "", "the option the threshold is measured on, Pass if left empty")
+	countAbstain := flags.Bool("count-abstain", false, "count abstentions toward the threshold")
+	quorum := flags.Int("quorum", 0, "how many people must vote for the result to stand")
+	quorumPercent := flags.Int("quorum-percent", 0, "what percentage of the voter roll must vote for the result to stand")
+	who := flags.String("eligibility", "", "who can vote: default, everyone, groups or users")
+	groups := flags.String("groups", "", "comma-separated groups that can vote, with -eligibility groups")
+	excluded := flags.String("exclude-groups", "", "comma-separated groups that can't vote, with -eligibility groups")
+	users := flags.String("users", "", "comma-separated usernames that can vote, with -eligibility users")
+	opens := flags.String("opens", "", "when the poll opens, as 2006-01-02T15:04 in local time or RFC 3339")
+	closes := flags.String("closes", "", "when the poll closes, as 2006-01-02T15:04 in local time or RFC 3339")
+	draft := flags.Bool("draft", false, "save the poll as a draft instead of publishing it")
+	flags.Parse(args)
+
+	create := api.CreatePoll{
+		PollSettings: api.PollSettings{
+			ShortDescription: *title,
+			LongDescription:  *description,
+			VoteType:         *voteType,
+			AllowWriteIns:    *writeIns,
+			TieBreak:         *tieBreak,
+			Threshold:        *threshold,
+			Motion:           *motion,
+			CountAbstain:     *countAbstain,
+			Quorum:           *quorum,
+			QuorumPercent:    *quorumPercent,
+			Eligibility: eligibility.Policy{
+				Kind:           eligibility.Kind(*who),
+				Groups:         splitList(*groups),
+				ExcludedGroups: splitList(*excluded),
+				Users:          splitList(*users),
+			},
+		},
+		Draft: *draft,
+	}
+	if create.ShortDescription == "" {
+		return create, errors.New("a poll needs a -title")
+	}
+	if *options != "" {
+		create.Options = splitList(*options)
+	} else if presetOptions, ok := api.OptionPresets[*preset]; ok {
+		create.Options = presetOptions
+	} else {
+		return create, fmt.Errorf("unknown preset %q", *preset)
+	}
+	switch *voteType {
+	case "stv":
+		create.Seats = *seats
+	case "score", "star":
+		create.MaxScore = *maxScore
+	}
+
+	for _, t := range []struct {
+		value string
+		set   **time.Time
+	}{{*opens, &create.OpensAt}, {*closes, &create.ClosesAt}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := parseTime(t.value)
+		if err != nil {
+			return create, err
+		}
+		*t.set = &parsed
+	}
+
+	return create, nil
+}
+
+// ballotFor turns the choices given to the vote command into a ballot for a
+// poll of voteType
+func ballotFor(voteType string, choices []string) (api.Ballot, error) {
+	var ballot api.Ballot
+	switch voteType {
+	case "simple":
+		if len(choices) != 1 {
+			return ballot, errors.New("vote for exactly one choice in a simple poll")
+		}
+		ballot.Option = choices[0]
+	case "ranked", "condorcet", "stv":
+		ballot.Ranks = make(map[string]int)
+		for i, choice := range choices {
+			if _, ok := ballot.Ranks[choice]; ok {
+				return ballot, fmt.Errorf("%q is ranked more than once", choice)
+			}
+			ballot.Ranks[choice] = i + 1
+		}
+	case "approval":
+		ballot.Approved = choices
+	case "score", "star":
+		ballot.Scores = make(map[string]int)
+		for _, choice := range choices {
+			option, score, ok := strings.Cut(choice, "=")
+			if !ok {
+				return ballot, fmt.Errorf("score %q as %s=<score>", choice, choice)
+			}
+			value, err := strconv.Atoi(score)
+			if err != nil {
+				return ballot, fmt.Errorf("the score of %q must be a whole number", option)
+			}
+			ballot.Scores[option] = value
+		}
+	default:
+		return ballot, fmt.Errorf("unknown poll type %q", voteType)
+	}
+	return ballot, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, use 2006-01-02T15:04 or RFC 3339", value)
+	}
+	return t, nil
+}
+
+func onlyArg(command string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: votectl %s <id>", command)
+	}
+	return args[0], nil
+}
+
+// splitList splits a comma-separated flag, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// byCount sorts the keys of counts from most to least, then by name
+func byCount[T int | float64](counts map[string]T) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/computersciencehouse/vote/api"
+)
+
+func TestBallotFor(t *testing.T) {
+	tests := []struct {
+		voteType string
+		choices  []string
+		want     api.Ballot
+		fails    bool
+	}{
+		{"simple", []string{"Pass"}, api.Ballot{Option: "Pass"}, false},
+		{"simple", []string{"Pass", "Fail"}, api.Ballot{}, true},
+		{"ranked", []string{"B", "A", "C"}, api.Ballot{Ranks: map[string]int{"B": 1, "A": 2, "C": 3}}, false},
+		{"stv", []string{"A", "A"}, api.Ballot{}, true},
+		{"approval", []string{"A", "C"}, api.Ballot{Approved: []string{"A", "C"}}, false},
+		{"star", []string{"A=5", "B=0"}, api.Ballot{Scores: map[string]int{"A": 5, "B": 0}}, false},
+		{"score", []string{"A"}, api.Ballot{}, true},
+		{"score", []string{"A=high"}, api.Ballot{}, true},
+		{"plurality", []string{"A"}, api.Ballot{}, true},
+	}
+	for _, test := range tests {
+		got, err := ballotFor(test.voteType, test.choices)
+		if test.fails {
+			if err == nil {
+				t.Errorf("ballotFor(%q, %v) = %+v, want an error", test.voteType, test.choices, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ballotFor(%q, %v) = %+v, %v, want %+v", test.voteType, test.choices, got, err, test.want)
+		}
+	}
+}
+
+func TestParseCreate(t *testing.T) {
+	create, err := parseCreate([]string{"-title", "Budget", "-preset", "fail-conditional"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(create.Options, api.OptionPresets["fail-conditional"]) || create.VoteType != "simple" || create.MaxScore != 0 {
+		t.Errorf("parseCreate = %+v", create)
+	}
+
+	create, err = parseCreate([]string{"-title", "Chair", "-type", "star", "-options", "Alice, Bob,,", "-closes", "2030-01-02T15:04:05Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(create.Options, []string{"Alice", "Bob"}) || create.MaxScore != 5 || create.ClosesAt == nil || create.ClosesAt.Year() != 2030 {
+		t.Errorf("parseCreate = %+v", create)
+	}
+
+	if _, err := parseCreate([]string{"-preset", "pass-fail"}); err == nil {
+		t.Error("parseCreate without a title succeeded")
+	}
+	if _, err := parseCreate([]string{"-title", "Budget", "-preset", "yes-no"}); err == nil {
+		t.Error("parseCreate with an unknown preset succeeded")
+	}
+}
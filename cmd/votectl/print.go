@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/tally"
+)
+
+func printPolls(w io.Writer, polls []api.Poll) {
+	if len(polls) == 0 {
+		fmt.Fprintln(w, "No polls.")
+		return
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTITLE\tTYPE\tCREATED BY\tSTATE")
+	for _, poll := range polls {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", poll.Id, poll.ShortDescription, poll.VoteType, poll.CreatedBy, pollState(&poll))
+	}
+	table.Flush()
+}
+
+func printPoll(w io.Writer, poll *api.Poll) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "ID:\t%s\n", poll.Id)
+	fmt.Fprintf(table, "Title:\t%s\n", poll.ShortDescription)
+	if poll.LongDescription != "" {
+		fmt.Fprintf(table, "Description:\t%s\n", poll.LongDescription)
+	}
+	fmt.Fprintf(table, "Type:\t%s\n", poll.VoteType)
+	fmt.Fprintf(table, "Options:\t%s\n", strings.Join(poll.Options, ", "))
+	if poll.AllowWriteIns {
+		fmt.Fprintln(table, "Write-ins:\tallowed")
+	}
+	if poll.Seats > 0 {
+		fmt.Fprintf(table, "Seats:\t%d\n", poll.Seats)
+	}
+	if poll.MaxScore > 0 {
+		fmt.Fprintf(table, "Max score:\t%d\n", poll.MaxScore)
+	}
+	if poll.Threshold != "" {
+		motion := poll.Motion
+		if motion == "" {
+			motion = tally.Pass
+		}
+		fmt.Fprintf(table, "Threshold:\t%s for %s\n", poll.Threshold, motion)
+	}
+	if poll.Quorum > 0 {
+		fmt.Fprintf(table, "Quorum:\t%d\n", poll.Quorum)
+	}
+	if poll.QuorumPercent > 0 {
+		fmt.Fprintf(table, "Quorum of the roll:\t%d%%\n", poll.QuorumPercent)
+	}
+	if poll.OpensAt != nil {
+		fmt.Fprintf(table, "Opens:\t%s\n", poll.OpensAt.Local().Format(time.RFC1123))
+	}
+	if poll.ClosesAt != nil {
+		fmt.Fprintf(table, "Closes:\t%s\n", poll.ClosesAt.Local().Format(time.RFC1123))
+	}
+	fmt.Fprintf(table, "Created by:\t%s\n", poll.CreatedBy)
+	fmt.Fprintf(table, "State:\t%s\n", pollState(poll))
+	table.Flush()
+}
+
+func pollState(poll *api.Poll) string {
+	state := "closed"
+	switch {
+	case poll.Draft:
+		state = "draft"
+	case poll.Scheduled:
+		state = "scheduled"
+	case poll.Open:
+		state = "open"
+	}
+	if poll.Hidden {
+		state += ", hidden"
+	}
+	return state
+}
+
+func printResults(w io.Writer, results *api.Results) {
+	state := "closed"
+	if results.Open {
+		state = "open"
+	}
+	fmt.Fprintf(w, "%d voted, the poll is %s\n\n", results.Voters, state)
+
+	result := results.Result
+	if result == nil || len(result.Rounds) == 0 && result.STV == nil && result.Condorcet == nil {
+		fmt.Fprintln(w, "No votes yet.")
+		return
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch {
+	case result.STV != nil:
+		count := result.STV
+		fmt.Fprintf(w, "%d seat(s), quota %.2f\n", count.Seats, count.Quota)
+		if len(count.Rounds) > 0 {
+			last := count.Rounds[len(count.Rounds)-1]
+			fmt.Fprintln(table, "OPTION\tVOTES")
+			for _, option := range byCount(last.Votes) {
+				fmt.Fprintf(table, "%s\t%.2f\n", option, last.Votes[option])
+			}
+		}
+	case result.Condorcet != nil:
+		fmt.Fprintln(table, "RANK\tOPTION")
+		for i, tied := range result.Condorcet.Ranking {
+			fmt.Fprintf(table, "%d\t%s\n", i+1, strings.Join(tied, ", "))
+		}
+	case result.Score != nil:
+		count := result.Score
+		fmt.Fprintln(table, "OPTION\tTOTAL\tAVERAGE")
+		for _, option := range byCount(count.Totals) {
+			fmt.Fprintf(table, "%s\t%d\t%.2f\n", option, count.Totals[option], count.Averages[option])
+		}
+		if runoff := count.Runoff; runoff != nil {
+			table.Flush()
+			fmt.Fprintln(w, "\nRunoff:")
+			for _, finalist := range runoff.Finalists {
+				fmt.Fprintf(table, "%s\t%d\n", finalist, runoff.Preferences[finalist])
+			}
+			fmt.Fprintf(table, "no preference\t%d\n", runoff.NoPreference)
+		}
+	case result.Approval != nil:
+		tallies := result.Rounds[0].Tallies
+		fmt.Fprintln(table, "OPTION\tAPPROVALS\tPERCENT")
+		for _, option := range byCount(tallies) {
+			fmt.Fprintf(table, "%s\t%d\t%.1f%%\n", option, tallies[option], result.Approval.Percentages[option])
+		}
+	default:
+		// Plurality has one round, instant runoff one per elimination
+		for i, round := range result.Rounds {
+			if len(result.Rounds) > 1 {
+				table.Flush()
+				fmt.Fprintf(w, "Round %d:\n", i+1)
+			}
+			fmt.Fprintln(table, "OPTION\tVOTES")
+			for _, option := range byCount(round.Tallies) {
+				fmt.Fprintf(table, "%s\t%d\n", option, round.Tallies[option])
+			}
+			if round.Eliminated != "" {
+				fmt.Fprintf(table, "eliminated %s\n", round.Eliminated)
+			}
+			if len(round.NoVotes) > 0 {
+				fmt.Fprintf(table, "eliminated %s with no votes\n", strings.Join(round.NoVotes, ", "))
+			}
+		}
+	}
+	table.Flush()
+	fmt.Fprintln(w)
+
+	printWinners(w, result)
+	if outcome := result.Outcome; outcome != nil {
+		printOutcome(w, outcome)
+	}
+}
+
+func printWinners(w io.Writer, result *tally.Result) {
+	switch {
+	case len(result.Pending) > 0:
+		fmt.Fprintf(w, "Waiting on the creator to break a tie between %s\n", strings.Join(result.Pending, ", "))
+	case len(result.Winners) == 0:
+	case result.STV != nil:
+		fmt.Fprintf(w, "Elected: %s\n", strings.Join(result.Winners, ", "))
+	case result.Tie():
+		fmt.Fprintf(w, "Tied: %s\n", strings.Join(result.Winners, ", "))
+	default:
+		fmt.Fprintf(w, "Winner: %s\n", result.Winners[0])
+	}
+}
+
+func printOutcome(w io.Writer, outcome *tally.Outcome) {
+	status := map[tally.Status]string{
+		tally.StatusPassed:    "Passed",
+		tally.StatusFailed:    "Failed",
+		tally.StatusNoQuorum:  "No quorum",
+		tally.StatusUndecided: "Not decided",
+	}[outcome.Status]
+	switch {
+	case outcome.Status == tally.StatusNoQuorum && outcome.QuorumPercent > 0:
+		fmt.Fprintf(w, "%s: %d voted, %d needed (%d%% of %d)\n", status, outcome.Turnout, outcome.Quorum, outcome.QuorumPercent, outcome.Roll)
+	case outcome.Status == tally.StatusNoQuorum:
+		fmt.Fprintf(w, "%s: %d voted, %d needed\n", status, outcome.Turnout, outcome.Quorum)
+	case outcome.Threshold == "":
+		fmt.Fprintf(w, "%s\n", status)
+	case outcome.Option == "":
+		fmt.Fprintf(w, "%s: there is no option to measure the threshold on\n", status)
+	default:
+		fmt.Fprintf(w, "%s: %s got %d of %d votes, %d needed for %s\n", status, outcome.Option, outcome.Votes, outcome.Counted, outcome.Needed, outcome.Threshold)
+	}
+}
@@ -2,8 +2,8 @@ package database
 
 import (
 	"context"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"time"
 )
 
 type Action struct {
@@ -12,16 +12,10 @@ type Action struct {
 	Date   primitive.DateTime `bson:"date"`
 	User   string             `bson:"user"`
 	Action string             `bson:"action"`
+	// Token is the id of the API token the action was taken with, if any
+	Token string `bson:"token,omitempty"`
 }
 
 func WriteAction(ctx context.Context, action *Action) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	_, err := Client.Database(db).Collection("actions").InsertOne(ctx, action)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.WriteAction(ctx, action)
 }
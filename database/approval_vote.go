@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ApprovalVote struct {
+	Id      string             `bson:"_id,omitempty"`
+	PollId  primitive.ObjectID `bson:"pollId"`
+	Options []string           `bson:"options"`
+}
+
+func CastApprovalVote(ctx context.Context, vote *ApprovalVote, voter *Voter) error {
+	return store.CastApprovalVote(ctx, vote, voter)
+}
+
+// NormalizeApprovals checks an approval ballot against the poll, trims its
+// write-in and drops any choice approved of more than once. It returns a
+// *BallotError when nothing is approved of, or a write-in isn't allowed, is
+// blank, duplicates an option, or is one of several.
+func (poll *Poll) NormalizeApprovals(choices []string) ([]string, error) {
+	ballotErr := &BallotError{Fields: make(map[string]string)}
+	if len(choices) == 0 {
+		ballotErr.Message = "Approve of at least one option"
+		return nil, ballotErr
+	}
+
+	var normalized []string
+	writeIns := 0
+	for _, choice := range choices {
+		name := choice
+		if !containsValue(poll.Options, choice) {
+			var problem string
+			if name, problem = poll.writeIn(choice); problem != "" {
+				ballotErr.Fields[choice] = problem
+				continue
+			}
+		}
+		if containsValue(normalized, name) {
+			continue
+		}
+		if !containsValue(poll.Options, name) {
+			writeIns++
+		}
+		normalized = append(normalized, name)
+	}
+	if writeIns > 1 {
+		ballotErr.Message = "Only one write-in can be approved of"
+	}
+	if ballotErr.Message != "" || len(ballotErr.Fields) > 0 {
+		return nil, ballotErr
+	}
+	return normalized, nil
+}
@@ -19,7 +19,8 @@ const (
 	Updated UpsertResult = 1
 )
 
-var Client = Connect()
+// Client is the MongoDB connection opened by Connect
+var Client *mongo.Client
 var db = os.Getenv("VOTE_MONGO_DB")
 
 func Connect() *mongo.Client {
@@ -39,10 +40,15 @@ func Connect() *mongo.Client {
 
 	logging.Logger.WithFields(logrus.Fields{"module": "database", "method": "Connect"}).Info("connected to mongodb")
 
+	Client = client
 	return client
 }
 
 func Disconnect() {
+	if Client == nil {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
 	defer cancel()
 
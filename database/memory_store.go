@@ -0,0 +1,439 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is a Store that keeps everything in process memory. It is meant
+// for tests and local demos; nothing survives a restart.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	polls         map[string]*Poll
+	simpleVotes   []SimpleVote
+	rankedVotes   []RankedVote
+	approvalVotes []ApprovalVote
+	scoreVotes    []ScoreVote
+	voters        []Voter
+	actions       []Action
+	tokens        []*Token
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		polls: make(map[string]*Poll),
+	}
+}
+
+func (s *MemoryStore) GetPoll(ctx context.Context, id string) (*Poll, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	poll, ok := s.polls[id]
+	if !ok {
+		return nil, ErrPollNotFound
+	}
+	return copyPoll(poll), nil
+}
+
+func (s *MemoryStore) CreatePoll(ctx context.Context, poll *Poll) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := copyPoll(poll)
+	stored.Id = primitive.NewObjectID().Hex()
+	s.polls[stored.Id] = stored
+	return stored.Id, nil
+}
+
+func (s *MemoryStore) UpdatePoll(ctx context.Context, poll *Poll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.polls[poll.Id]; !ok {
+		return nil
+	}
+	for _, voter := range s.voters {
+		if voter.PollId.Hex() == poll.Id {
+			return ErrPollHasVotes
+		}
+	}
+	s.polls[poll.Id] = copyPoll(poll)
+	return nil
+}
+
+func (s *MemoryStore) OpenPoll(ctx context.Context, id string, roll *VoterRoll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[id]
+	if !ok || !poll.Scheduled {
+		return ErrPollNotScheduled
+	}
+	poll.Open = true
+	poll.Scheduled = false
+	poll.Roll = copyRoll(roll)
+	return nil
+}
+
+func (s *MemoryStore) ClosePoll(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[id]
+	if !ok || !(poll.Open || poll.Scheduled) {
+		return ErrPollClosed
+	}
+	poll.Open = false
+	poll.Scheduled = false
+	return nil
+}
+
+func (s *MemoryStore) HidePoll(ctx context.Context, id string) error {
+	return s.updatePoll(id, func(poll *Poll) { poll.Hidden = true })
+}
+
+func (s *MemoryStore) RevealPoll(ctx context.Context, id string) error {
+	return s.updatePoll(id, func(poll *Poll) { poll.Hidden = false })
+}
+
+func (s *MemoryStore) AddTieBreakDecision(ctx context.Context, id string, candidate string) error {
+	return s.updatePoll(id, func(poll *Poll) { poll.TieBreakDecisions = append(poll.TieBreakDecisions, candidate) })
+}
+
+// updatePoll applies update to the stored poll. Like an update in Mongo, an
+// unknown id is not an error.
+func (s *MemoryStore) updatePoll(id string, update func(poll *Poll)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if poll, ok := s.polls[id]; ok {
+		update(poll)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetOpenPolls(ctx context.Context) ([]*Poll, error) {
+	return s.findPolls(func(poll *Poll) bool {
+		return poll.Open
+	}), nil
+}
+
+func (s *MemoryStore) GetScheduledPolls(ctx context.Context) ([]*Poll, error) {
+	return s.findPolls(func(poll *Poll) bool {
+		return poll.Scheduled
+	}), nil
+}
+
+func (s *MemoryStore) GetDraftPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	return s.findPolls(func(poll *Poll) bool {
+		return poll.Draft && poll.CreatedBy == userId
+	}), nil
+}
+
+func (s *MemoryStore) GetClosedOwnedPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	return s.findPolls(func(poll *Poll) bool {
+		return !poll.Open && !poll.Scheduled && !poll.Draft && poll.CreatedBy == userId
+	}), nil
+}
+
+func (s *MemoryStore) GetClosedVotedPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	s.mu.RLock()
+	voted := make(map[string]bool)
+	for _, voter := range s.voters {
+		if voter.UserId == userId {
+			voted[voter.PollId.Hex()] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	return s.findPolls(func(poll *Poll) bool {
+		return !poll.Open && !poll.Scheduled && !poll.Draft && voted[poll.Id]
+	}), nil
+}
+
+func (s *MemoryStore) findPolls(match func(poll *Poll) bool) []*Poll {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var polls []*Poll
+	for _, poll := range s.polls {
+		if match(poll) {
+			polls = append(polls, copyPoll(poll))
+		}
+	}
+	return polls
+}
+
+func (s *MemoryStore) CastSimpleVote(ctx context.Context, vote *SimpleVote, voter *Voter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasVoted(voter.PollId.Hex(), voter.UserId) {
+		return ErrAlreadyVoted
+	}
+
+	stored := *vote
+	stored.Id = primitive.NewObjectID().Hex()
+	s.simpleVotes = append(s.simpleVotes, stored)
+	s.addVoter(voter)
+	return nil
+}
+
+func (s *MemoryStore) CastRankedVote(ctx context.Context, vote *RankedVote, voter *Voter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasVoted(voter.PollId.Hex(), voter.UserId) {
+		return ErrAlreadyVoted
+	}
+
+	stored := *vote
+	stored.Id = primitive.NewObjectID().Hex()
+	stored.Options = make(map[string]int, len(vote.Options))
+	for option, rank := range vote.Options {
+		stored.Options[option] = rank
+	}
+	s.rankedVotes = append(s.rankedVotes, stored)
+	s.addVoter(voter)
+	return nil
+}
+
+func (s *MemoryStore) CastApprovalVote(ctx context.Context, vote *ApprovalVote, voter *Voter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasVoted(voter.PollId.Hex(), voter.UserId) {
+		return ErrAlreadyVoted
+	}
+
+	stored := *vote
+	stored.Id = primitive.NewObjectID().Hex()
+	stored.Options = append([]string(nil), vote.Options...)
+	s.approvalVotes = append(s.approvalVotes, stored)
+	s.addVoter(voter)
+	return nil
+}
+
+func (s *MemoryStore) CastScoreVote(ctx context.Context, vote *ScoreVote, voter *Voter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasVoted(voter.PollId.Hex(), voter.UserId) {
+		return ErrAlreadyVoted
+	}
+
+	stored := *vote
+	stored.Id = primitive.NewObjectID().Hex()
+	stored.Scores = make(map[string]int, len(vote.Scores))
+	for option, score := range vote.Scores {
+		stored.Scores[option] = score
+	}
+	s.scoreVotes = append(s.scoreVotes, stored)
+	s.addVoter(voter)
+	return nil
+}
+
+// addVoter records voter, the caller must hold the write lock
+func (s *MemoryStore) addVoter(voter *Voter) {
+	stored := *voter
+	stored.Id = primitive.NewObjectID().Hex()
+	s.voters = append(s.voters, stored)
+}
+
+func (s *MemoryStore) GetSimpleVotes(ctx context.Context, pollId string) ([]SimpleVote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var votes []SimpleVote
+	for _, vote := range s.simpleVotes {
+		if vote.PollId.Hex() == pollId {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (s *MemoryStore) GetRankedVotes(ctx context.Context, pollId string) ([]RankedVote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var votes []RankedVote
+	for _, vote := range s.rankedVotes {
+		if vote.PollId.Hex() == pollId {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (s *MemoryStore) GetApprovalVotes(ctx context.Context, pollId string) ([]ApprovalVote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var votes []ApprovalVote
+	for _, vote := range s.approvalVotes {
+		if vote.PollId.Hex() == pollId {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (s *MemoryStore) GetScoreVotes(ctx context.Context, pollId string) ([]ScoreVote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var votes []ScoreVote
+	for _, vote := range s.scoreVotes {
+		if vote.PollId.Hex() == pollId {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (s *MemoryStore) HasVoted(ctx context.Context, pollId, userId string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.hasVoted(pollId, userId), nil
+}
+
+func (s *MemoryStore) CountVoters(ctx context.Context, pollId string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, voter := range s.voters {
+		if voter.PollId.Hex() == pollId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) GetVoters(ctx context.Context, pollId string) ([]Voter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var voters []Voter
+	for _, voter := range s.voters {
+		if voter.PollId.Hex() == pollId {
+			voters = append(voters, voter)
+		}
+	}
+	return voters, nil
+}
+
+// hasVoted reports whether userId voted in pollId, the caller must hold the lock
+func (s *MemoryStore) hasVoted(pollId, userId string) bool {
+	for _, voter := range s.voters {
+		if voter.PollId.Hex() == pollId && voter.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) WriteAction(ctx context.Context, action *Action) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *action
+	stored.Id = primitive.NewObjectID().Hex()
+	s.actions = append(s.actions, stored)
+	return nil
+}
+
+// Actions returns every action written so far, oldest first
+func (s *MemoryStore) Actions() []Action {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Action(nil), s.actions...)
+}
+
+func (s *MemoryStore) CreateToken(ctx context.Context, token *Token) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := copyToken(token)
+	stored.Id = primitive.NewObjectID().Hex()
+	s.tokens = append(s.tokens, stored)
+	return stored.Id, nil
+}
+
+func (s *MemoryStore) GetToken(ctx context.Context, hash string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.tokens {
+		if token.Hash == hash {
+			return copyToken(token), nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *MemoryStore) GetTokens(ctx context.Context, userId string) ([]*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens []*Token
+	for _, token := range s.tokens {
+		if token.UserId == userId {
+			tokens = append(tokens, copyToken(token))
+		}
+	}
+	return tokens, nil
+}
+
+func (s *MemoryStore) RevokeToken(ctx context.Context, id, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.tokens {
+		if token.Id == id && token.UserId == userId {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func copyToken(token *Token) *Token {
+	c := *token
+	c.Groups = append([]string(nil), token.Groups...)
+	c.Scopes = append([]string(nil), token.Scopes...)
+	return &c
+}
+
+func copyPoll(poll *Poll) *Poll {
+	c := *poll
+	c.Options = append([]string(nil), poll.Options...)
+	c.TieBreakDecisions = append([]string(nil), poll.TieBreakDecisions...)
+	c.Eligibility.Groups = append([]string(nil), poll.Eligibility.Groups...)
+	c.Eligibility.ExcludedGroups = append([]string(nil), poll.Eligibility.ExcludedGroups...)
+	c.Eligibility.Users = append([]string(nil), poll.Eligibility.Users...)
+	c.Roll = copyRoll(poll.Roll)
+	if poll.OpensAt != nil {
+		opensAt := *poll.OpensAt
+		c.OpensAt = &opensAt
+	}
+	if poll.ClosesAt != nil {
+		closesAt := *poll.ClosesAt
+		c.ClosesAt = &closesAt
+	}
+	return &c
+}
+
+func copyRoll(roll *VoterRoll) *VoterRoll {
+	if roll == nil {
+		return nil
+	}
+	c := *roll
+	c.Voters = append([]string(nil), roll.Voters...)
+	return &c
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCastVoteTwice(t *testing.T) {
+	ctx := context.Background()
+	pollId := primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		cast func(s *MemoryStore, voter *Voter) error
+	}{
+		{"simple", func(s *MemoryStore, voter *Voter) error {
+			return s.CastSimpleVote(ctx, &SimpleVote{PollId: pollId, Option: "Pass"}, voter)
+		}},
+		{"ranked", func(s *MemoryStore, voter *Voter) error {
+			return s.CastRankedVote(ctx, &RankedVote{PollId: pollId, Options: map[string]int{"Pizza": 1}}, voter)
+		}},
+		{"approval", func(s *MemoryStore, voter *Voter) error {
+			return s.CastApprovalVote(ctx, &ApprovalVote{PollId: pollId, Options: []string{"Pizza"}}, voter)
+		}},
+		{"score", func(s *MemoryStore, voter *Voter) error {
+			return s.CastScoreVote(ctx, &ScoreVote{PollId: pollId, Scores: map[string]int{"Pizza": 5}}, voter)
+		}},
+	}
+	for _, test := range tests {
+		s := NewMemoryStore()
+		if err := test.cast(s, &Voter{PollId: pollId, UserId: "alice"}); err != nil {
+			t.Fatalf("%s: first vote = %v", test.name, err)
+		}
+		if err := test.cast(s, &Voter{PollId: pollId, UserId: "alice"}); !errors.Is(err, ErrAlreadyVoted) {
+			t.Errorf("%s: second vote = %v, want ErrAlreadyVoted", test.name, err)
+		}
+		// Someone else can still vote
+		if err := test.cast(s, &Voter{PollId: pollId, UserId: "bob"}); err != nil {
+			t.Errorf("%s: another user's vote = %v", test.name, err)
+		}
+
+		voters, err := s.CountVoters(ctx, pollId.Hex())
+		if err != nil || voters != 2 {
+			t.Errorf("%s: CountVoters = %d, %v, want 2", test.name, voters, err)
+		}
+		votes := len(s.simpleVotes) + len(s.rankedVotes) + len(s.approvalVotes) + len(s.scoreVotes)
+		if votes != 2 {
+			t.Errorf("%s: %d votes stored, want 2", test.name, votes)
+		}
+	}
+}
+
+func TestOpenAndCloseOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	id, _ := s.CreatePoll(ctx, &Poll{Scheduled: true})
+
+	// Only the first of several instances opening the poll does it
+	if err := s.OpenPoll(ctx, id, &VoterRoll{Voters: []string{"alice"}}); err != nil {
+		t.Fatalf("OpenPoll = %v", err)
+	}
+	if err := s.OpenPoll(ctx, id, &VoterRoll{Voters: []string{"bob"}}); !errors.Is(err, ErrPollNotScheduled) {
+		t.Errorf("opening again = %v, want ErrPollNotScheduled", err)
+	}
+	if poll, _ := s.GetPoll(ctx, id); !poll.Open || poll.Roll.Voters[0] != "alice" {
+		t.Errorf("after opening twice, poll = %+v", poll)
+	}
+
+	if err := s.ClosePoll(ctx, id); err != nil {
+		t.Fatalf("ClosePoll = %v", err)
+	}
+	if err := s.ClosePoll(ctx, id); !errors.Is(err, ErrPollClosed) {
+		t.Errorf("closing again = %v, want ErrPollClosed", err)
+	}
+	if err := s.OpenPoll(ctx, id, nil); !errors.Is(err, ErrPollNotScheduled) {
+		t.Errorf("opening a closed poll = %v, want ErrPollNotScheduled", err)
+	}
+}
+
+func TestUpdatePollAfterVote(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	id, _ := s.CreatePoll(ctx, &Poll{Open: true, Options: []string{"Pizza", "Tacos"}})
+	pollId, _ := primitive.ObjectIDFromHex(id)
+
+	if err := s.UpdatePoll(ctx, &Poll{Id: id, Open: true, Options: []string{"Pizza", "Sushi"}}); err != nil {
+		t.Fatalf("UpdatePoll before voting = %v", err)
+	}
+	if err := s.CastSimpleVote(ctx, &SimpleVote{PollId: pollId, Option: "Sushi"}, &Voter{PollId: pollId, UserId: "alice"}); err != nil {
+		t.Fatalf("CastSimpleVote = %v", err)
+	}
+	// An edit checked before the vote must not rewrite the options under it
+	if err := s.UpdatePoll(ctx, &Poll{Id: id, Open: true, Options: []string{"Pizza", "Tacos"}}); !errors.Is(err, ErrPollHasVotes) {
+		t.Errorf("UpdatePoll after voting = %v, want ErrPollHasVotes", err)
+	}
+	if poll, _ := s.GetPoll(ctx, id); poll.Options[1] != "Sushi" {
+		t.Errorf("after a refused edit, options = %v", poll.Options)
+	}
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/computersciencehouse/vote/logging"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventsSize is how many bytes of recent events the capped events collection
+// keeps
+const eventsSize = 1 << 20
+
+// MongoBackplane is an sse.Backplane shared by every instance connected to
+// the same database. Events are written to a capped collection, which each
+// instance follows with a tailable cursor, so every instance sees them in the
+// order they were inserted. Each event is numbered after the last one on its
+// topic as it is inserted, so an id means the same event on every instance
+// and a topic's ids increase in the order its events arrive.
+type MongoBackplane struct {
+	database *mongo.Database
+}
+
+// event is an sse.NotificationEvent as it is stored
+type event struct {
+	Id      primitive.ObjectID `bson:"_id,omitempty"`
+	Seq     uint64             `bson:"seq"`
+	Topic   string             `bson:"topic"`
+	Event   string             `bson:"event"`
+	Payload interface{}        `bson:"payload"`
+	Date    time.Time          `bson:"date"`
+}
+
+func NewMongoBackplane(client *mongo.Client) *MongoBackplane {
+	b := &MongoBackplane{database: client.Database(db)}
+	if err := b.ensureCollection(context.TODO()); err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "database", "method": "NewMongoBackplane"}).Error("error creating the events collection")
+	}
+	return b
+}
+
+// ensureCollection creates the capped events collection, which tailable
+// cursors need, and the unique (topic, seq) index that numbers its events
+func (b *MongoBackplane) ensureCollection(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := b.database.CreateCollection(ctx, "events", options.CreateCollection().SetCapped(true).SetSizeInBytes(eventsSize))
+	var commandErr mongo.CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists") {
+		return err
+	}
+	_, err = b.database.Collection("events").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "topic", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Publish numbers the event after the last one inserted on its topic. The
+// unique (topic, seq) index lets only one of the events published at once
+// take each number, and the others try again with the next, so a topic's
+// seqs increase in the order its events are inserted.
+func (b *MongoBackplane) Publish(ctx context.Context, e sse.NotificationEvent) error {
+	for {
+		seq, err := b.lastSeq(ctx, e.Topic)
+		if err != nil {
+			return err
+		}
+		_, err = b.database.Collection("events").InsertOne(ctx, event{
+			Seq:     seq + 1,
+			Topic:   e.Topic,
+			Event:   e.EventName,
+			Payload: e.Payload,
+			Date:    time.Now(),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Remembered for when the topic's events have all been pushed out
+		// of the collection
+		_, err = b.database.Collection("counters").UpdateOne(ctx,
+			bson.M{"_id": "events:" + e.Topic},
+			bson.M{"$max": bson.M{"seq": seq + 1}},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	}
+}
+
+// lastSeq returns the seq of the last event inserted on topic, 0 if there
+// has never been one
+func (b *MongoBackplane) lastSeq(ctx context.Context, topic string) (uint64, error) {
+	var last, counter struct {
+		Seq uint64 `bson:"seq"`
+	}
+	err := b.database.Collection("events").FindOne(ctx,
+		bson.M{"topic": topic},
+		options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}),
+	).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	err = b.database.Collection("counters").FindOne(ctx, bson.M{"_id": "events:" + topic}).Decode(&counter)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	if counter.Seq > last.Seq {
+		return counter.Seq, nil
+	}
+	return last.Seq, nil
+}
+
+// Subscribe follows the events published from now on, in the order they were
+// inserted. Seqs are only ordered within a topic, so the events are never
+// filtered by seq. A tailable cursor dies when the collection is empty
+// or it falls too far behind, so it is opened again and skips the events up
+// to the last one sent.
+func (b *MongoBackplane) Subscribe(ctx context.Context, events chan<- sse.NotificationEvent) error {
+	collection := b.database.Collection("events")
+
+	var last event
+	err := collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"$natural": -1})).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	for {
+		// If the last event sent has been pushed out of the collection,
+		// everything still in it is newer
+		var kept int64
+		if !last.Id.IsZero() {
+			kept, err = collection.CountDocuments(ctx, bson.M{"_id": last.Id})
+		}
+		var cursor *mongo.Cursor
+		if err == nil {
+			cursor, err = collection.Find(ctx, bson.M{},
+				options.Find().SetCursorType(options.TailableAwait).SetMaxAwaitTime(time.Second),
+			)
+		}
+		if err == nil {
+			skipping := kept > 0
+			for cursor.Next(ctx) {
+				var e event
+				if err := cursor.Decode(&e); err != nil {
+					logging.Logger.WithFields(logrus.Fields{"error": err, "module": "database", "method": "Subscribe"}).Error("error decoding an event")
+					continue
+				}
+				if skipping {
+					skipping = e.Id != last.Id
+					continue
+				}
+				last = e
+				select {
+				case events <- sse.NotificationEvent{Id: e.Seq, Topic: e.Topic, EventName: e.Event, Payload: e.Payload}:
+				case <-ctx.Done():
+					cursor.Close(context.TODO())
+					return ctx.Err()
+				}
+			}
+			err = cursor.Err()
+			cursor.Close(context.TODO())
+		}
+		if err != nil && ctx.Err() == nil {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "database", "method": "Subscribe"}).Error("error following events")
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/computersciencehouse/vote/logging"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by a MongoDB database
+type MongoStore struct {
+	database *mongo.Database
+}
+
+// NewMongoStore exits if the indexes votes depend on can't be created, since
+// without them a user could vote twice
+func NewMongoStore(client *mongo.Client) *MongoStore {
+	s := &MongoStore{database: client.Database(db)}
+	if err := s.ensureIndexes(context.TODO()); err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "database", "method": "NewMongoStore"}).Fatal("error creating indexes, remove any duplicate voters and restart")
+	}
+	return s
+}
+
+// ensureIndexes creates the unique (pollId, userId) index on voters that
+// makes casting a vote exactly-once, and the index API tokens are looked up by.
+// It also creates the votes collection, which can't be created inside the
+// transaction votes are cast in on MongoDB before 4.4.
+func (s *MongoStore) ensureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.database.CreateCollection(ctx, "votes")
+	var commandErr mongo.CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists") {
+		return err
+	}
+
+	_, err = s.database.Collection("voters").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "pollId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.database.Collection("tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoStore) GetPoll(ctx context.Context, id string) (*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(id)
+	var poll Poll
+	if err := s.database.Collection("polls").FindOne(ctx, map[string]interface{}{"_id": objId}).Decode(&poll); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPollNotFound
+		}
+		return nil, err
+	}
+
+	return &poll, nil
+}
+
+func (s *MongoStore) CreatePoll(ctx context.Context, poll *Poll) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.database.Collection("polls").InsertOne(ctx, poll)
+	if err != nil {
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// UpdatePoll replaces the poll only while its votes counter, which castVote
+// increments in the same transaction as it records a voter, is unset
+func (s *MongoStore) UpdatePoll(ctx context.Context, poll *Poll) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(poll.Id)
+	// The id is stored as an ObjectID, so leave it out of the replacement
+	replacement := *poll
+	replacement.Id = ""
+
+	result, err := s.database.Collection("polls").ReplaceOne(ctx,
+		map[string]interface{}{"_id": objId, "votes": map[string]interface{}{"$in": []interface{}{nil, 0}}},
+		replacement,
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPollHasVotes
+	}
+
+	return nil
+}
+
+func (s *MongoStore) OpenPoll(ctx context.Context, id string, roll *VoterRoll) error {
+	updated, err := s.setPollFieldsWhere(ctx, id,
+		map[string]interface{}{"scheduled": true},
+		map[string]interface{}{"open": true, "scheduled": false, "roll": roll},
+	)
+	if err == nil && !updated {
+		return ErrPollNotScheduled
+	}
+	return err
+}
+
+func (s *MongoStore) ClosePoll(ctx context.Context, id string) error {
+	updated, err := s.setPollFieldsWhere(ctx, id,
+		map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"open": true},
+			map[string]interface{}{"scheduled": true},
+		}},
+		map[string]interface{}{"open": false, "scheduled": false},
+	)
+	if err == nil && !updated {
+		return ErrPollClosed
+	}
+	return err
+}
+
+func (s *MongoStore) HidePoll(ctx context.Context, id string) error {
+	return s.setPollFields(ctx, id, map[string]interface{}{"hidden": true})
+}
+
+func (s *MongoStore) RevealPoll(ctx context.Context, id string) error {
+	return s.setPollFields(ctx, id, map[string]interface{}{"hidden": false})
+}
+
+func (s *MongoStore) AddTieBreakDecision(ctx context.Context, id string, candidate string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(id)
+
+	_, err := s.database.Collection("polls").UpdateOne(ctx, map[string]interface{}{"_id": objId}, map[string]interface{}{"$push": map[string]interface{}{"tieBreakDecisions": candidate}})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MongoStore) setPollFields(ctx context.Context, id string, fields map[string]interface{}) error {
+	_, err := s.setPollFieldsWhere(ctx, id, map[string]interface{}{}, fields)
+	return err
+}
+
+// setPollFieldsWhere sets fields on the poll only if it also matches filter,
+// and reports whether it did
+func (s *MongoStore) setPollFieldsWhere(ctx context.Context, id string, filter, fields map[string]interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(id)
+	filter["_id"] = objId
+
+	result, err := s.database.Collection("polls").UpdateOne(ctx, filter, map[string]interface{}{"$set": fields})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (s *MongoStore) GetOpenPolls(ctx context.Context) ([]*Poll, error) {
+	return s.findPolls(ctx, map[string]interface{}{"open": true})
+}
+
+func (s *MongoStore) GetScheduledPolls(ctx context.Context) ([]*Poll, error) {
+	return s.findPolls(ctx, map[string]interface{}{"scheduled": true})
+}
+
+func (s *MongoStore) GetDraftPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	return s.findPolls(ctx, map[string]interface{}{"createdBy": userId, "draft": true})
+}
+
+func (s *MongoStore) GetClosedOwnedPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	return s.findPolls(ctx, map[string]interface{}{
+		"createdBy": userId,
+		"open":      false,
+		"scheduled": map[string]interface{}{"$ne": true},
+		"draft":     map[string]interface{}{"$ne": true},
+	})
+}
+
+func (s *MongoStore) findPolls(ctx context.Context, filter map[string]interface{}) ([]*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.database.Collection("polls").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var polls []*Poll
+	if err := cursor.All(ctx, &polls); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+func (s *MongoStore) GetClosedVotedPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.database.Collection("voters").Aggregate(ctx, mongo.Pipeline{
+		{{
+			"$match", bson.D{
+				{"userId", userId},
+			},
+		}},
+		{{
+			"$lookup", bson.D{
+				{"from", "polls"},
+				{"localField", "pollId"},
+				{"foreignField", "_id"},
+				{"as", "polls"},
+			},
+		}},
+		{{
+			"$unwind", bson.D{
+				{"path", "$polls"},
+				{"preserveNullAndEmptyArrays", false},
+			},
+		}},
+		{{
+			"$replaceRoot", bson.D{
+				{"newRoot", "$polls"},
+			},
+		}},
+		{{
+			"$match", bson.D{
+				{"open", false},
+				{"scheduled", bson.D{{"$ne", true}}},
+				{"draft", bson.D{{"$ne", true}}},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var polls []*Poll
+	if err := cursor.All(ctx, &polls); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+func (s *MongoStore) CastSimpleVote(ctx context.Context, vote *SimpleVote, voter *Voter) error {
+	return s.castVote(ctx, vote, voter)
+}
+
+func (s *MongoStore) CastRankedVote(ctx context.Context, vote *RankedVote, voter *Voter) error {
+	return s.castVote(ctx, vote, voter)
+}
+
+func (s *MongoStore) CastApprovalVote(ctx context.Context, vote *ApprovalVote, voter *Voter) error {
+	return s.castVote(ctx, vote, voter)
+}
+
+func (s *MongoStore) CastScoreVote(ctx context.Context, vote *ScoreVote, voter *Voter) error {
+	return s.castVote(ctx, vote, voter)
+}
+
+// castVote records the voter and their vote in one transaction, so a user is
+// never marked as voted without a ballot being counted. The unique index on
+// voters means only one submission per user can commit.
+func (s *MongoStore) castVote(ctx context.Context, vote interface{}, voter *Voter) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	session, err := s.database.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		if _, err := s.database.Collection("voters").InsertOne(ctx, voter); err != nil {
+			return nil, err
+		}
+		// UpdatePoll only replaces a poll whose counter is still zero
+		_, err := s.database.Collection("polls").UpdateOne(ctx,
+			map[string]interface{}{"_id": voter.PollId},
+			map[string]interface{}{"$inc": map[string]interface{}{"votes": 1}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return s.database.Collection("votes").InsertOne(ctx, vote)
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyVoted
+	}
+	return err
+}
+
+func (s *MongoStore) GetSimpleVotes(ctx context.Context, pollId string) ([]SimpleVote, error) {
+	var votes []SimpleVote
+	if err := s.findVotes(ctx, pollId, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (s *MongoStore) GetRankedVotes(ctx context.Context, pollId string) ([]RankedVote, error) {
+	var votes []RankedVote
+	if err := s.findVotes(ctx, pollId, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (s *MongoStore) GetApprovalVotes(ctx context.Context, pollId string) ([]ApprovalVote, error) {
+	var votes []ApprovalVote
+	if err := s.findVotes(ctx, pollId, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (s *MongoStore) GetScoreVotes(ctx context.Context, pollId string) ([]ScoreVote, error) {
+	var votes []ScoreVote
+	if err := s.findVotes(ctx, pollId, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (s *MongoStore) findVotes(ctx context.Context, pollId string, votes interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pId, err := primitive.ObjectIDFromHex(pollId)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := s.database.Collection("votes").Find(ctx, map[string]interface{}{"pollId": pId})
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, votes)
+}
+
+func (s *MongoStore) HasVoted(ctx context.Context, pollId, userId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pId, err := primitive.ObjectIDFromHex(pollId)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := s.database.Collection("voters").CountDocuments(ctx, map[string]interface{}{"pollId": pId, "userId": userId})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *MongoStore) CountVoters(ctx context.Context, pollId string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pId, err := primitive.ObjectIDFromHex(pollId)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := s.database.Collection("voters").CountDocuments(ctx, map[string]interface{}{"pollId": pId})
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (s *MongoStore) GetVoters(ctx context.Context, pollId string) ([]Voter, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pId, err := primitive.ObjectIDFromHex(pollId)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.database.Collection("voters").Find(ctx, map[string]interface{}{"pollId": pId})
+	if err != nil {
+		return nil, err
+	}
+
+	var voters []Voter
+	if err := cursor.All(ctx, &voters); err != nil {
+		return nil, err
+	}
+	return voters, nil
+}
+
+func (s *MongoStore) WriteAction(ctx context.Context, action *Action) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := s.database.Collection("actions").InsertOne(ctx, action)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MongoStore) CreateToken(ctx context.Context, token *Token) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.database.Collection("tokens").InsertOne(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (s *MongoStore) GetToken(ctx context.Context, hash string) (*Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var token Token
+	if err := s.database.Collection("tokens").FindOne(ctx, map[string]interface{}{"hash": hash}).Decode(&token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (s *MongoStore) GetTokens(ctx context.Context, userId string) ([]*Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.database.Collection("tokens").Find(ctx, map[string]interface{}{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*Token
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *MongoStore) RevokeToken(ctx context.Context, id, userId string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(id)
+
+	_, err := s.database.Collection("tokens").UpdateOne(ctx, map[string]interface{}{"_id": objId, "userId": userId}, map[string]interface{}{"$set": map[string]interface{}{"revoked": true}})
+	return err
+}
@@ -2,11 +2,11 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/tally"
 )
 
 type Poll struct {
@@ -19,313 +19,239 @@ type Poll struct {
 	Open             bool     `bson:"open"`
 	Hidden           bool     `bson:"hidden"`
 	AllowWriteIns    bool     `bson:"writeins"`
+	// TieBreak is how ties for last place in a ranked poll are broken,
+	// TieBreakSeed makes random tie breaks repeatable, and TieBreakDecisions
+	// are the creator's choices when they break ties themselves
+	TieBreak          string   `bson:"tieBreak"`
+	TieBreakSeed      int64    `bson:"tieBreakSeed"`
+	TieBreakDecisions []string `bson:"tieBreakDecisions"`
+	// Seats is how many options an STV poll elects
+	Seats int `bson:"seats,omitempty"`
+	// MaxScore is the highest score a score or STAR ballot can give an option
+	MaxScore int `bson:"maxScore,omitempty"`
+	// Threshold is the share of the votes a simple or approval poll's motion
+	// needs to pass, measured with or without abstentions as set by
+	// CountAbstain. The motion is Motion, or Pass when that is empty. Quorum
+	// is the number of voters needed for the result to stand, and
+	// QuorumPercent the share of the roll, whichever is more.
+	Threshold     string `bson:"threshold,omitempty"`
+	Motion        string `bson:"motion,omitempty"`
+	CountAbstain  bool   `bson:"countAbstain,omitempty"`
+	Quorum        int    `bson:"quorum,omitempty"`
+	QuorumPercent int    `bson:"quorumPercent,omitempty"`
+	// Eligibility decides who can vote, and is the default policy when unset
+	Eligibility eligibility.Policy `bson:"eligibility"`
+	// Roll is who could vote when the poll opened. Polls opened without a
+	// directory have no roll, and check eligibility as each vote is cast.
+	Roll *VoterRoll `bson:"roll,omitempty"`
+	// Draft is set until the creator publishes the poll. A draft is only
+	// visible to its creator, who can still edit it.
+	Draft bool `bson:"draft,omitempty"`
+	// Scheduled is set while a poll is waiting for OpensAt, so it is neither
+	// open nor closed. ClosesAt is when an open poll is closed automatically.
+	Scheduled bool       `bson:"scheduled,omitempty"`
+	OpensAt   *time.Time `bson:"opensAt,omitempty"`
+	ClosesAt  *time.Time `bson:"closesAt,omitempty"`
 }
 
 const POLL_TYPE_SIMPLE = "simple"
 const POLL_TYPE_RANKED = "ranked"
+const POLL_TYPE_CONDORCET = "condorcet"
+const POLL_TYPE_STV = "stv"
+const POLL_TYPE_APPROVAL = "approval"
+const POLL_TYPE_SCORE = "score"
+const POLL_TYPE_STAR = "star"
+
+const TIE_BREAK_PREVIOUS_ROUND = string(tally.TieBreakPreviousRound)
+const TIE_BREAK_RANDOM = string(tally.TieBreakRandom)
+const TIE_BREAK_CREATOR = string(tally.TieBreakCreator)
+
+const THRESHOLD_MAJORITY = string(tally.ThresholdMajority)
+const THRESHOLD_TWO_THIRDS = string(tally.ThresholdTwoThirds)
+const THRESHOLD_THREE_QUARTERS = string(tally.ThresholdThreeQuarters)
+const THRESHOLD_UNANIMOUS = string(tally.ThresholdUnanimous)
+
+// IsRanked reports whether the poll is voted on with a ranked ballot
+func (poll *Poll) IsRanked() bool {
+	return poll.VoteType == POLL_TYPE_RANKED || poll.VoteType == POLL_TYPE_CONDORCET || poll.VoteType == POLL_TYPE_STV
+}
 
 func GetPoll(ctx context.Context, id string) (*Poll, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	objId, _ := primitive.ObjectIDFromHex(id)
-	var poll Poll
-	if err := Client.Database(db).Collection("polls").FindOne(ctx, map[string]interface{}{"_id": objId}).Decode(&poll); err != nil {
-		return nil, err
-	}
-
-	return &poll, nil
+	return store.GetPoll(ctx, id)
 }
 
-func (poll *Poll) Close(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+// VoterRoll is a snapshot of the eligible voters
+type VoterRoll struct {
+	TakenAt time.Time `bson:"takenAt"`
+	Voters  []string  `bson:"voters"`
+}
 
-	objId, _ := primitive.ObjectIDFromHex(poll.Id)
+// Start opens a scheduled poll for voting, with the roll taken as it opened
+func (poll *Poll) Start(ctx context.Context, roll *VoterRoll) error {
+	return store.OpenPoll(ctx, poll.Id, roll)
+}
 
-	_, err := Client.Database(db).Collection("polls").UpdateOne(ctx, map[string]interface{}{"_id": objId}, map[string]interface{}{"$set": map[string]interface{}{"open": false}})
+// NotVoted returns the usernames on the roll who haven't voted yet
+func (poll *Poll) NotVoted(ctx context.Context) ([]string, error) {
+	if poll.Roll == nil {
+		return nil, nil
+	}
+	voters, err := store.GetVoters(ctx, poll.Id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	voted := make(map[string]bool)
+	for _, voter := range voters {
+		voted[voter.UserId] = true
+	}
+	var notVoted []string
+	for _, username := range poll.Roll.Voters {
+		if !voted[username] {
+			notVoted = append(notVoted, username)
+		}
+	}
+	return notVoted, nil
 }
 
-func (poll *Poll) Hide(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	objId, _ := primitive.ObjectIDFromHex(poll.Id)
+// Update saves every field of the poll
+func (poll *Poll) Update(ctx context.Context) error {
+	return store.UpdatePoll(ctx, poll)
+}
 
-	_, err := Client.Database(db).Collection("polls").UpdateOne(ctx, map[string]interface{}{"_id": objId}, map[string]interface{}{"$set": map[string]interface{}{"hidden": true}})
+// Editable reports whether the poll can still be changed, which is only
+// until it closes or someone votes in it
+func (poll *Poll) Editable(ctx context.Context) (bool, error) {
+	if poll.Draft {
+		return true, nil
+	}
+	if !poll.Open && !poll.Scheduled {
+		return false, nil
+	}
+	voters, err := store.CountVoters(ctx, poll.Id)
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	return nil
+	return voters == 0, nil
 }
 
-func (poll *Poll) Reveal(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+func (poll *Poll) Close(ctx context.Context) error {
+	return store.ClosePoll(ctx, poll.Id)
+}
 
-	objId, _ := primitive.ObjectIDFromHex(poll.Id)
+func (poll *Poll) Hide(ctx context.Context) error {
+	return store.HidePoll(ctx, poll.Id)
+}
 
-	_, err := Client.Database(db).Collection("polls").UpdateOne(ctx, map[string]interface{}{"_id": objId}, map[string]interface{}{"$set": map[string]interface{}{"hidden": false}})
-	if err != nil {
-		return err
-	}
+func (poll *Poll) Reveal(ctx context.Context) error {
+	return store.RevealPoll(ctx, poll.Id)
+}
 
-	return nil
+// AddTieBreakDecision records the creator's choice of candidate to eliminate
+// in the next undecided tie
+func (poll *Poll) AddTieBreakDecision(ctx context.Context, candidate string) error {
+	return store.AddTieBreakDecision(ctx, poll.Id, candidate)
 }
 
 func CreatePoll(ctx context.Context, poll *Poll) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	result, err := Client.Database(db).Collection("polls").InsertOne(ctx, poll)
-	if err != nil {
-		return "", err
-	}
-
-	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+	return store.CreatePoll(ctx, poll)
 }
 
 func GetOpenPolls(ctx context.Context) ([]*Poll, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	cursor, err := Client.Database(db).Collection("polls").Find(ctx, map[string]interface{}{"open": true})
-	if err != nil {
-		return nil, err
-
-	}
+	return store.GetOpenPolls(ctx)
+}
 
-	var polls []*Poll
-	cursor.All(ctx, &polls)
+// GetScheduledPolls returns the polls waiting for their OpensAt time
+func GetScheduledPolls(ctx context.Context) ([]*Poll, error) {
+	return store.GetScheduledPolls(ctx)
+}
 
-	return polls, nil
+// GetDraftPolls returns the unpublished polls created by userId
+func GetDraftPolls(ctx context.Context, userId string) ([]*Poll, error) {
+	return store.GetDraftPolls(ctx, userId)
 }
 
 func GetClosedOwnedPolls(ctx context.Context, userId string) ([]*Poll, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	cursor, err := Client.Database(db).Collection("polls").Find(ctx, map[string]interface{}{"createdBy": userId, "open": false})
-	if err != nil {
-		return nil, err
-	}
-
-	var polls []*Poll
-	cursor.All(ctx, &polls)
-
-	return polls, nil
+	return store.GetClosedOwnedPolls(ctx, userId)
 }
 
 func GetClosedVotedPolls(ctx context.Context, userId string) ([]*Poll, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	cursor, err := Client.Database(db).Collection("votes").Aggregate(ctx, mongo.Pipeline{
-		{{
-			"$match", bson.D{
-				{"userId", userId},
-			},
-		}},
-		{{
-			"$lookup", bson.D{
-				{"from", "polls"},
-				{"localField", "pollId"},
-				{"foreignField", "_id"},
-				{"as", "polls"},
-			},
-		}},
-		{{
-			"$unwind", bson.D{
-				{"path", "$polls"},
-				{"preserveNullAndEmptyArrays", false},
-			},
-		}},
-		{{
-			"$replaceRoot", bson.D{
-				{"newRoot", "$polls"},
-			},
-		}},
-		{{
-			"$match", bson.D{
-				{"open", false},
-			},
-		}},
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	var polls []*Poll
-	cursor.All(ctx, &polls)
-
-	return polls, nil
+	return store.GetClosedVotedPolls(ctx, userId)
 }
 
-func (poll *Poll) GetResult(ctx context.Context) ([]map[string]int, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	pollId, _ := primitive.ObjectIDFromHex(poll.Id)
-
-	finalResult := make([]map[string]int, 0)
+func (poll *Poll) GetResult(ctx context.Context) (*tally.Result, error) {
+	tallyPoll := tally.Poll{
+		Options:       poll.Options,
+		TieBreak:      tally.TieBreak(poll.TieBreak),
+		Seed:          poll.TieBreakSeed,
+		Decisions:     poll.TieBreakDecisions,
+		Seats:         poll.Seats,
+		MaxScore:      poll.MaxScore,
+		Threshold:     tally.Threshold(poll.Threshold),
+		Motion:        poll.Motion,
+		CountAbstain:  poll.CountAbstain,
+		Quorum:        poll.Quorum,
+		QuorumPercent: poll.QuorumPercent,
+	}
+	if poll.Roll != nil {
+		tallyPoll.Roll = len(poll.Roll.Voters)
+	}
+	var ballots []tally.Ballot
 	switch poll.VoteType {
 
 	case POLL_TYPE_SIMPLE:
-		pollResult := make(map[string]int)
-		cursor, err := Client.Database(db).Collection("votes").Aggregate(ctx, mongo.Pipeline{
-			{{
-				"$match", bson.D{
-					{"pollId", pollId},
-				},
-			}},
-			{{
-				"$group", bson.D{
-					{"_id", "$option"},
-					{"count", bson.D{
-						{"$sum", 1},
-					}},
-				},
-			}},
-		})
+		tallyPoll.Method = tally.Plurality
+		votes, err := store.GetSimpleVotes(ctx, poll.Id)
 		if err != nil {
 			return nil, err
 		}
+		for _, vote := range votes {
+			ballots = append(ballots, tally.Ballot{Ranking: []string{vote.Option}})
+		}
 
-		var results []SimpleResult
-		cursor.All(ctx, &results)
-
-		// Start by setting all the results to zero
-		for _, opt := range poll.Options {
-			pollResult[opt] = 0
+	case POLL_TYPE_RANKED, POLL_TYPE_CONDORCET, POLL_TYPE_STV:
+		switch poll.VoteType {
+		case POLL_TYPE_RANKED:
+			tallyPoll.Method = tally.InstantRunoff
+		case POLL_TYPE_CONDORCET:
+			tallyPoll.Method = tally.Schulze
+		case POLL_TYPE_STV:
+			tallyPoll.Method = tally.STV
 		}
-		// Overwrite those with given votes and add write-ins
-		for _, r := range results {
-			pollResult[r.Option] = r.Count
+		votes, err := store.GetRankedVotes(ctx, poll.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, vote := range votes {
+			ballots = append(ballots, tally.RankedBallot(vote.Options))
 		}
-		finalResult = append(finalResult, pollResult)
-		return finalResult, nil
-
-	case POLL_TYPE_RANKED:
-		// We want to store those that were eliminated
-		eliminated := make([]string, 0)
 
-		// Get all votes
-		cursor, err := Client.Database(db).Collection("votes").Aggregate(ctx, mongo.Pipeline{
-			{{
-				"$match", bson.D{
-					{"pollId", pollId},
-				},
-			}},
-		})
+	case POLL_TYPE_APPROVAL:
+		tallyPoll.Method = tally.Approval
+		votes, err := store.GetApprovalVotes(ctx, poll.Id)
 		if err != nil {
 			return nil, err
 		}
-		var votesRaw []RankedVote
-		cursor.All(ctx, &votesRaw)
-
-		votes := make([][]string, 0)
-
-		//change ranked votes from a map (which is unordered) to a slice of votes (which is ordered)
-		//order is from first preference to last preference
-		for _, vote := range votesRaw {
-			temp, cf := context.WithTimeout(context.Background(), 1*time.Second)
-			optionList := orderOptions(vote.Options, temp)
-			cf()
-			votes = append(votes, optionList)
+		for _, vote := range votes {
+			ballots = append(ballots, tally.Ballot{Approved: vote.Options})
 		}
 
-		// Iterate until we have a winner
-		for {
-			// Contains candidates to number of votes in this round
-			tallied := make(map[string]int)
-			voteCount := 0
-			for _, picks := range votes {
-				// Go over picks until we find a non-eliminated candidate
-				for _, candidate := range picks {
-					if !containsValue(eliminated, candidate) {
-						if _, ok := tallied[candidate]; ok {
-							tallied[candidate]++
-						} else {
-							tallied[candidate] = 1
-						}
-						voteCount += 1
-						break
-					}
-				}
-			}
-			// Eliminate lowest vote getter
-			minVote := 1000000             //the smallest number of votes received thus far (to find who is in last)
-			minPerson := make([]string, 0) //the person(s) with the least votes that need removed
-			for person, vote := range tallied {
-				if vote < minVote { // this should always be true round one, to set a true "who is in last"
-					minVote = vote
-					minPerson = make([]string, 0)
-					minPerson = append(minPerson, person)
-				} else if vote == minVote {
-					minPerson = append(minPerson, person)
-				}
-			}
-			eliminated = append(eliminated, minPerson...)
-			finalResult = append(finalResult, tallied)
-			// If one person has all the votes, they win
-			if len(tallied) == 1 {
-				break
-			}
-
-			end := true
-			for str, val := range tallied {
-				// if any particular entry is above half remaining votes, they win and it ends
-				if val > (voteCount / 2) {
-					finalResult = append(finalResult, map[string]int{str: val})
-					end = true
-					break
-				}
-				// Check if all values in tallied are the same
-				// In that case, it's a tie?
-				if val != minVote {
-					end = false
-					break
-				}
-			}
-			if end {
-				break
-			}
+	case POLL_TYPE_SCORE, POLL_TYPE_STAR:
+		tallyPoll.Method = tally.Score
+		if poll.VoteType == POLL_TYPE_STAR {
+			tallyPoll.Method = tally.STAR
 		}
-		return finalResult, nil
-	}
-	return nil, nil
-}
-
-func containsValue(slice []string, value string) bool {
-	for _, item := range slice {
-		if item == value {
-			return true
+		votes, err := store.GetScoreVotes(ctx, poll.Id)
+		if err != nil {
+			return nil, err
 		}
-	}
-	return false
-}
-
-func orderOptions(options map[string]int, ctx context.Context) []string {
-	result := make([]string, 0, len(options))
-	order := 1
-	for order <= len(options) {
-		for option, preference := range options {
-			select {
-			case <-ctx.Done():
-				return make([]string, 0)
-			default:
-				if preference == order {
-					result = append(result, option)
-					order += 1
-				}
-			}
+		for _, vote := range votes {
+			ballots = append(ballots, tally.Ballot{Scores: vote.Scores})
 		}
+
+	default:
+		return nil, fmt.Errorf("unknown poll type %q", poll.VoteType)
 	}
-	return result
+
+	return tally.Count(tallyPoll, ballots)
 }
@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"strings"
 
+	"github.com/computersciencehouse/vote/tally"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -13,19 +15,119 @@ type RankedVote struct {
 	Options map[string]int     `bson:"options"`
 }
 
-
 func CastRankedVote(ctx context.Context, vote *RankedVote, voter *Voter) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	return store.CastRankedVote(ctx, vote, voter)
+}
+
+// BallotError explains why a ballot was rejected. Fields maps each choice with
+// a problem to a description of it, Message describes a problem with the
+// ballot as a whole.
+type BallotError struct {
+	Message string
+	Fields  map[string]string
+}
+
+func (err *BallotError) Error() string {
+	if err.Message != "" {
+		return err.Message
+	}
+	return "ballot has invalid choices"
+}
+
+// RankedMax is the largest rank a ballot in the poll may use
+func (poll *Poll) RankedMax() int {
+	if poll.AllowWriteIns {
+		return len(poll.Options) + 1
+	}
+	return len(poll.Options)
+}
+
+// NormalizeRanks checks a ranked ballot against the poll, trims its write-in
+// and renumbers its ranks from 1 without gaps, so 1, 2, 5 becomes 1, 2, 3. It
+// returns a *BallotError when a rank is outside 1 to RankedMax, two choices
+// share a rank, nothing is ranked, or a write-in isn't allowed, is blank or
+// duplicates an option.
+func (poll *Poll) NormalizeRanks(ranks map[string]int) (map[string]int, error) {
+	ballotErr := &BallotError{Fields: make(map[string]string)}
+	if len(ranks) == 0 {
+		ballotErr.Message = "Rank at least one option"
+		return nil, ballotErr
+	}
 
-	_, err := Client.Database(db).Collection("votes").InsertOne(ctx, vote)
-	if err != nil {
-		return err
+	max := poll.RankedMax()
+	used := make(map[int][]string)
+	writeIns := 0
+	named := make(map[string]int, len(ranks))
+	for choice, rank := range ranks {
+		name := choice
+		if !containsValue(poll.Options, choice) {
+			var problem string
+			if name, problem = poll.writeIn(choice); problem != "" {
+				ballotErr.Fields[choice] = problem
+				continue
+			}
+			writeIns++
+		}
+		if rank < 1 || rank > max {
+			ballotErr.Fields[choice] = fmt.Sprintf("Rank must be between 1 and %d", max)
+			continue
+		}
+		used[rank] = append(used[rank], name)
+		named[name] = rank
 	}
-	_, err = Client.Database(db).Collection("voters").InsertOne(ctx, voter)
-	if err != nil {
-		return err
+	if writeIns > 1 {
+		ballotErr.Message = "Only one write-in can be ranked"
 	}
+	for rank, choices := range used {
+		if len(choices) > 1 {
+			for _, choice := range choices {
+				ballotErr.Fields[choice] = fmt.Sprintf("Rank %d is given to more than one option", rank)
+			}
+		}
+	}
+	if ballotErr.Message != "" || len(ballotErr.Fields) > 0 {
+		return nil, ballotErr
+	}
+
+	normalized := make(map[string]int, len(named))
+	for i, choice := range tally.RankedBallot(named).Ranking {
+		normalized[choice] = i + 1
+	}
+	return normalized, nil
+}
+
+func containsValue(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeIn trims a choice that isn't one of the poll's options, and describes
+// what is wrong with it as a write-in, if anything. A blank write-in would be
+// counted as a ballot with no choices left.
+func (poll *Poll) writeIn(choice string) (name string, problem string) {
+	name = strings.TrimSpace(choice)
+	switch {
+	case !poll.AllowWriteIns:
+		return name, "This poll doesn't allow write-ins"
+	case name == "":
+		return name, "Give your write-in a name"
+	case matchesOption(poll.Options, name):
+		return name, "Your write-in is already an option"
+	}
+	return name, ""
+}
 
-	return nil
+// matchesOption reports whether a write-in is an option with different case
+// or spacing
+func matchesOption(options []string, writeIn string) bool {
+	for _, opt := range options {
+		if strings.EqualFold(strings.TrimSpace(opt), strings.TrimSpace(writeIn)) {
+			return true
+		}
+	}
+	return false
 }
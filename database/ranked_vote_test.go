@@ -0,0 +1,143 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteIns(t *testing.T) {
+	poll := &Poll{Options: []string{"Pizza", "Tacos"}, AllowWriteIns: true, MaxScore: 5}
+
+	ranks, err := poll.NormalizeRanks(map[string]int{"Pizza": 1, "  Sushi ": 3})
+	if want := map[string]int{"Pizza": 1, "Sushi": 2}; err != nil || !reflect.DeepEqual(ranks, want) {
+		t.Errorf("NormalizeRanks = %v, %v, want %v", ranks, err, want)
+	}
+	approved, err := poll.NormalizeApprovals([]string{"Sushi ", "Pizza", " Sushi"})
+	if want := []string{"Sushi", "Pizza"}; err != nil || !reflect.DeepEqual(approved, want) {
+		t.Errorf("NormalizeApprovals = %v, %v, want %v", approved, err, want)
+	}
+	scores, err := poll.NormalizeScores(map[string]int{"Tacos": 2, "Sushi\t": 5})
+	if want := map[string]int{"Tacos": 2, "Sushi": 5}; err != nil || !reflect.DeepEqual(scores, want) {
+		t.Errorf("NormalizeScores = %v, %v, want %v", scores, err, want)
+	}
+	option, err := poll.NormalizeOption(" Sushi")
+	if err != nil || option != "Sushi" {
+		t.Errorf("NormalizeOption = %q, %v, want Sushi", option, err)
+	}
+
+	// A blank write-in would be counted as a ballot with nothing left on it
+	for _, blank := range []string{"", "   "} {
+		checks := map[string]error{}
+		_, checks["NormalizeRanks"] = poll.NormalizeRanks(map[string]int{"Pizza": 1, blank: 2})
+		_, checks["NormalizeApprovals"] = poll.NormalizeApprovals([]string{"Pizza", blank})
+		_, checks["NormalizeScores"] = poll.NormalizeScores(map[string]int{"Pizza": 1, blank: 2})
+		for name, err := range checks {
+			var ballotErr *BallotError
+			if !errors.As(err, &ballotErr) || ballotErr.Fields[blank] != "Give your write-in a name" {
+				t.Errorf("%s with write-in %q = %v, want it rejected", name, blank, err)
+			}
+		}
+	}
+}
+
+func TestNormalizeRanks(t *testing.T) {
+	poll := &Poll{Options: []string{"Pizza", "Tacos", "Sushi"}}
+	writeIns := &Poll{Options: []string{"Pizza", "Tacos", "Sushi"}, AllowWriteIns: true}
+
+	tests := []struct {
+		name  string
+		poll  *Poll
+		ranks map[string]int
+		want  map[string]int
+		// fields are the problems a rejected ballot has with each choice,
+		// which poll.tmpl shows beside them
+		fields  map[string]string
+		message string
+	}{
+		{
+			name:  "in order",
+			poll:  poll,
+			ranks: map[string]int{"Pizza": 1, "Tacos": 2, "Sushi": 3},
+			want:  map[string]int{"Pizza": 1, "Tacos": 2, "Sushi": 3},
+		},
+		{
+			name:  "gaps are renumbered",
+			poll:  poll,
+			ranks: map[string]int{"Pizza": 3, "Sushi": 1},
+			want:  map[string]int{"Sushi": 1, "Pizza": 2},
+		},
+		{
+			name:  "a write-in can use the extra rank",
+			poll:  writeIns,
+			ranks: map[string]int{"Pizza": 1, "Ramen": 4},
+			want:  map[string]int{"Pizza": 1, "Ramen": 2},
+		},
+		{
+			name:   "duplicate ranks",
+			poll:   poll,
+			ranks:  map[string]int{"Pizza": 1, "Tacos": 2, "Sushi": 2},
+			fields: map[string]string{"Tacos": "Rank 2 is given to more than one option", "Sushi": "Rank 2 is given to more than one option"},
+		},
+		{
+			name:   "rank above RankedMax",
+			poll:   poll,
+			ranks:  map[string]int{"Pizza": 1, "Tacos": 4},
+			fields: map[string]string{"Tacos": "Rank must be between 1 and 3"},
+		},
+		{
+			name:   "zero rank",
+			poll:   poll,
+			ranks:  map[string]int{"Pizza": 0},
+			fields: map[string]string{"Pizza": "Rank must be between 1 and 3"},
+		},
+		{
+			name:   "negative rank",
+			poll:   poll,
+			ranks:  map[string]int{"Pizza": 1, "Sushi": -2},
+			fields: map[string]string{"Sushi": "Rank must be between 1 and 3"},
+		},
+		{
+			name:   "write-in not allowed",
+			poll:   poll,
+			ranks:  map[string]int{"Ramen": 1},
+			fields: map[string]string{"Ramen": "This poll doesn't allow write-ins"},
+		},
+		{
+			name:    "nothing ranked",
+			poll:    poll,
+			ranks:   map[string]int{},
+			message: "Rank at least one option",
+		},
+		{
+			name:    "two write-ins",
+			poll:    writeIns,
+			ranks:   map[string]int{"Ramen": 1, "Curry": 2},
+			message: "Only one write-in can be ranked",
+			fields:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.poll.NormalizeRanks(tt.ranks)
+			if tt.want != nil {
+				if err != nil || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NormalizeRanks = %v, %v, want %v", got, err, tt.want)
+				}
+				return
+			}
+
+			var ballotErr *BallotError
+			if !errors.As(err, &ballotErr) {
+				t.Fatalf("NormalizeRanks = %v, %v, want a *BallotError", got, err)
+			}
+			if ballotErr.Message != tt.message {
+				t.Errorf("Message = %q, want %q", ballotErr.Message, tt.message)
+			}
+			if tt.fields != nil && !reflect.DeepEqual(ballotErr.Fields, tt.fields) {
+				t.Errorf("Fields = %v, want %v", ballotErr.Fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScoreVote struct {
+	Id     string             `bson:"_id,omitempty"`
+	PollId primitive.ObjectID `bson:"pollId"`
+	Scores map[string]int     `bson:"scores"`
+}
+
+func CastScoreVote(ctx context.Context, vote *ScoreVote, voter *Voter) error {
+	return store.CastScoreVote(ctx, vote, voter)
+}
+
+// NormalizeScores checks a score ballot against the poll and trims its
+// write-in. It returns a *BallotError when a score is outside 0 to MaxScore,
+// nothing is scored, or a write-in isn't allowed, is blank, duplicates an
+// option, or is one of several.
+func (poll *Poll) NormalizeScores(scores map[string]int) (map[string]int, error) {
+	ballotErr := &BallotError{Fields: make(map[string]string)}
+	if len(scores) == 0 {
+		ballotErr.Message = "Score at least one option"
+		return nil, ballotErr
+	}
+
+	normalized := make(map[string]int, len(scores))
+	writeIns := 0
+	for choice, score := range scores {
+		name := choice
+		if !containsValue(poll.Options, choice) {
+			var problem string
+			if name, problem = poll.writeIn(choice); problem != "" {
+				ballotErr.Fields[choice] = problem
+				continue
+			}
+			writeIns++
+		}
+		if score < 0 || score > poll.MaxScore {
+			ballotErr.Fields[choice] = fmt.Sprintf("Score must be between 0 and %d", poll.MaxScore)
+		}
+		normalized[name] = score
+	}
+	if writeIns > 1 {
+		ballotErr.Message = "Only one write-in can be scored"
+	}
+	if ballotErr.Message != "" || len(ballotErr.Fields) > 0 {
+		return nil, ballotErr
+	}
+	return normalized, nil
+}
@@ -2,7 +2,7 @@ package database
 
 import (
 	"context"
-	"time"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -13,23 +13,23 @@ type SimpleVote struct {
 	Option string             `bson:"option"`
 }
 
-type SimpleResult struct {
-	Option string `bson:"_id"`
-	Count  int    `bson:"count"`
-}
-
-func CastSimpleVote(ctx context.Context, vote *SimpleVote, voter *Voter) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	_, err := Client.Database(db).Collection("votes").InsertOne(ctx, vote)
-	if err != nil {
-		return err
+// NormalizeOption checks a simple ballot against the poll and trims its
+// write-in. It returns a *BallotError when nothing is chosen, or a write-in
+// isn't allowed or duplicates an option.
+func (poll *Poll) NormalizeOption(option string) (string, error) {
+	if containsValue(poll.Options, option) {
+		return option, nil
 	}
-	_, err = Client.Database(db).Collection("voters").InsertOne(ctx, voter)
-	if err != nil {
-		return err
+	if strings.TrimSpace(option) == "" {
+		return "", &BallotError{Message: "Choose an option"}
 	}
+	name, problem := poll.writeIn(option)
+	if problem != "" {
+		return "", &BallotError{Fields: map[string]string{option: problem}}
+	}
+	return name, nil
+}
 
-	return nil
+func CastSimpleVote(ctx context.Context, vote *SimpleVote, voter *Voter) error {
+	return store.CastSimpleVote(ctx, vote, voter)
 }
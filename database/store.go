@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrPollNotFound is returned by a Store when no poll has the requested id
+var ErrPollNotFound = errors.New("poll not found")
+
+// ErrAlreadyVoted is returned when casting a vote for a user who has already
+// voted in the poll. Neither the vote nor the voter are recorded.
+var ErrAlreadyVoted = errors.New("user has already voted in this poll")
+
+// ErrPollNotScheduled is returned when opening a poll that is no longer
+// waiting to open, usually because another instance opened it first
+var ErrPollNotScheduled = errors.New("poll is not scheduled to open")
+
+// ErrPollClosed is returned when closing a poll that has already closed
+var ErrPollClosed = errors.New("poll has already closed")
+
+// ErrPollHasVotes is returned when updating a poll someone has voted in, which
+// would leave their vote under options it wasn't cast for
+var ErrPollHasVotes = errors.New("poll has votes and can't be changed")
+
+// Store is the storage backend for polls, votes, voters and actions. The
+// package level functions delegate to the Store set with SetStore.
+type Store interface {
+	GetPoll(ctx context.Context, id string) (*Poll, error)
+	CreatePoll(ctx context.Context, poll *Poll) (string, error)
+	// UpdatePoll fails with ErrPollHasVotes once anyone has voted, checked
+	// atomically with casting so a vote can't land between check and update
+	UpdatePoll(ctx context.Context, poll *Poll) error
+	// Opening and closing only change a poll that is still scheduled, or
+	// still open or scheduled, so only one of several instances doing it at
+	// once succeeds. The others get ErrPollNotScheduled or ErrPollClosed.
+	OpenPoll(ctx context.Context, id string, roll *VoterRoll) error
+	ClosePoll(ctx context.Context, id string) error
+	HidePoll(ctx context.Context, id string) error
+	RevealPoll(ctx context.Context, id string) error
+	AddTieBreakDecision(ctx context.Context, id string, candidate string) error
+	GetOpenPolls(ctx context.Context) ([]*Poll, error)
+	GetScheduledPolls(ctx context.Context) ([]*Poll, error)
+	GetDraftPolls(ctx context.Context, userId string) ([]*Poll, error)
+	GetClosedOwnedPolls(ctx context.Context, userId string) ([]*Poll, error)
+	GetClosedVotedPolls(ctx context.Context, userId string) ([]*Poll, error)
+
+	// Casting stores the vote and the voter together, or neither of them. A
+	// second vote for the same (pollId, userId) fails with ErrAlreadyVoted.
+	CastSimpleVote(ctx context.Context, vote *SimpleVote, voter *Voter) error
+	CastRankedVote(ctx context.Context, vote *RankedVote, voter *Voter) error
+	CastApprovalVote(ctx context.Context, vote *ApprovalVote, voter *Voter) error
+	CastScoreVote(ctx context.Context, vote *ScoreVote, voter *Voter) error
+	GetSimpleVotes(ctx context.Context, pollId string) ([]SimpleVote, error)
+	GetRankedVotes(ctx context.Context, pollId string) ([]RankedVote, error)
+	GetApprovalVotes(ctx context.Context, pollId string) ([]ApprovalVote, error)
+	GetScoreVotes(ctx context.Context, pollId string) ([]ScoreVote, error)
+	HasVoted(ctx context.Context, pollId, userId string) (bool, error)
+	CountVoters(ctx context.Context, pollId string) (int, error)
+	GetVoters(ctx context.Context, pollId string) ([]Voter, error)
+
+	WriteAction(ctx context.Context, action *Action) error
+
+	CreateToken(ctx context.Context, token *Token) (string, error)
+	GetToken(ctx context.Context, hash string) (*Token, error)
+	GetTokens(ctx context.Context, userId string) ([]*Token, error)
+	RevokeToken(ctx context.Context, id, userId string) error
+}
+
+var store Store
+
+// SetStore selects the Store used by the package level functions
+func SetStore(s Store) {
+	store = s
+}
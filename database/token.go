@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrTokenNotFound is returned by a Store when no API token has the requested
+// hash
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is a personal API token. It acts as the user who made it, but can
+// only do what its Scopes allow and stops working at ExpiresAt. FullName and
+// Groups are what the user had when it was made, for when there's no
+// directory to look up what they have now. Only a hash of the secret is
+// stored, so it can't be read back.
+type Token struct {
+	Id        string    `bson:"_id,omitempty"`
+	UserId    string    `bson:"userId"`
+	FullName  string    `bson:"fullName"`
+	Groups    []string  `bson:"groups"`
+	Name      string    `bson:"name"`
+	Hash      string    `bson:"hash"`
+	Scopes    []string  `bson:"scopes"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Revoked   bool      `bson:"revoked"`
+}
+
+// HashToken is how the secret of a token is stored and looked up
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasScope reports whether the token may be used for scope
+func (token *Token) HasScope(scope string) bool {
+	return containsValue(token.Scopes, scope)
+}
+
+// Expired reports whether the token can no longer be used at now. Tokens made
+// before tokens expired have no ExpiresAt, so they have expired too.
+func (token *Token) Expired(now time.Time) bool {
+	return !now.Before(token.ExpiresAt)
+}
+
+func CreateToken(ctx context.Context, token *Token) (string, error) {
+	return store.CreateToken(ctx, token)
+}
+
+// GetToken finds the token with the secret hashed to hash, even if it has
+// been revoked
+func GetToken(ctx context.Context, hash string) (*Token, error) {
+	return store.GetToken(ctx, hash)
+}
+
+// GetTokens returns every token userId has made
+func GetTokens(ctx context.Context, userId string) ([]*Token, error) {
+	return store.GetTokens(ctx, userId)
+}
+
+// RevokeToken stops the token with id from being used, if userId made it
+func RevokeToken(ctx context.Context, id, userId string) error {
+	return store.RevokeToken(ctx, id, userId)
+}
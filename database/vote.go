@@ -2,7 +2,6 @@ package database
 
 import (
 	"context"
-	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -13,18 +12,11 @@ type Voter struct {
 	UserId string             `bson:"userId"`
 }
 
-func HasVoted(ctx context.Context, pollId, userId string) (bool, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	pId, err := primitive.ObjectIDFromHex(pollId)
-	if err != nil {
-		return false, err
-	}
+// CountVoters returns how many users have voted in the poll
+func CountVoters(ctx context.Context, pollId string) (int, error) {
+	return store.CountVoters(ctx, pollId)
+}
 
-	count, err := Client.Database(db).Collection("voters").CountDocuments(ctx, map[string]interface{}{"pollId": pId, "userId": userId})
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
+func HasVoted(ctx context.Context, pollId, userId string) (bool, error) {
+	return store.HasVoted(ctx, pollId, userId)
 }
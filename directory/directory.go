@@ -0,0 +1,45 @@
+// Package directory lists the members who could be eligible to vote, so a
+// poll's voter roll can be taken when it opens.
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// Member is someone listed in the directory
+type Member struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Groups   []string `json:"groups"`
+}
+
+// Directory is a source of members
+type Directory interface {
+	Members(ctx context.Context) ([]Member, error)
+}
+
+// File is a Directory read from a JSON array of members. The file is read
+// every time it is asked for members, so it can be changed while the server
+// is running.
+type File struct {
+	Path string
+}
+
+func NewFile(path string) *File {
+	return &File{Path: path}
+}
+
+func (f *File) Members(ctx context.Context) ([]Member, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []Member
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
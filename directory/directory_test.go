@@ -0,0 +1,29 @@
+package directory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestFileMembers(t *testing.T) {
+	members, err := NewFile("testdata/members.json").Members(context.Background())
+	if err != nil {
+		t.Fatalf("Members() error = %v", err)
+	}
+
+	want := []Member{
+		{Username: "alice", Name: "Alice Anderson", Groups: []string{"member", "active", "eboard"}},
+		{Username: "bob", Name: "Bob Brown", Groups: []string{"member", "active", "fall_coop"}},
+		{Username: "carol", Name: "Carol Clark", Groups: []string{"member"}},
+	}
+	if !reflect.DeepEqual(members, want) {
+		t.Errorf("Members() = %+v, want %+v", members, want)
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	if _, err := NewFile("testdata/missing.json").Members(context.Background()); err == nil {
+		t.Errorf("Members() of a missing file should fail")
+	}
+}
@@ -0,0 +1,134 @@
+// Package eligibility decides who can vote in a poll. Each poll carries a
+// Policy, which an Engine evaluates against the voter trying to take part.
+package eligibility
+
+import (
+	"fmt"
+	"time"
+)
+
+type Kind string
+
+const (
+	// KindDefault allows active members who are not on co-op this semester,
+	// and never anyone in 10 weeks. Polls without a policy use it.
+	KindDefault Kind = "default"
+	// KindEveryone allows anyone who can log in
+	KindEveryone Kind = "everyone"
+	// KindGroups allows members of any of Policy.Groups who are in none of
+	// Policy.ExcludedGroups
+	KindGroups Kind = "groups"
+	// KindUsers allows only the usernames in Policy.Users
+	KindUsers Kind = "users"
+)
+
+// Policy is the eligibility rule of a poll
+type Policy struct {
+	Kind           Kind     `bson:"kind" json:"kind"`
+	Groups         []string `bson:"groups,omitempty" json:"groups,omitempty"`
+	ExcludedGroups []string `bson:"excludedGroups,omitempty" json:"excludedGroups,omitempty"`
+	Users          []string `bson:"users,omitempty" json:"users,omitempty"`
+}
+
+// Voter is who is asking to vote
+type Voter struct {
+	Username string
+	Groups   []string
+}
+
+// Engine decides whether a voter is eligible under a policy
+type Engine interface {
+	Eligible(policy Policy, voter Voter) (bool, error)
+}
+
+// Rule evaluates one kind of policy at the time now
+type Rule func(policy Policy, voter Voter, now time.Time) bool
+
+// RuleEngine is an Engine that looks up a Rule for each kind of policy
+type RuleEngine struct {
+	rules map[Kind]Rule
+	// Now is the clock rules are evaluated with
+	Now func() time.Time
+}
+
+// NewEngine returns a RuleEngine with a rule for each of the built-in kinds
+func NewEngine() *RuleEngine {
+	engine := &RuleEngine{
+		rules: make(map[Kind]Rule),
+		Now:   time.Now,
+	}
+	engine.Register(KindDefault, defaultRule)
+	engine.Register(KindEveryone, func(Policy, Voter, time.Time) bool { return true })
+	engine.Register(KindGroups, groupsRule)
+	engine.Register(KindUsers, usersRule)
+	return engine
+}
+
+// Register adds or replaces the rule for a kind of policy
+func (engine *RuleEngine) Register(kind Kind, rule Rule) {
+	engine.rules[kind] = rule
+}
+
+func (engine *RuleEngine) Eligible(policy Policy, voter Voter) (bool, error) {
+	kind := policy.Kind
+	if kind == "" {
+		kind = KindDefault
+	}
+	rule, ok := engine.rules[kind]
+	if !ok {
+		return false, fmt.Errorf("unknown eligibility policy %q", kind)
+	}
+	return rule(policy, voter, engine.Now()), nil
+}
+
+// defaultRule is the eligibility rule from the constitution: active members,
+// except anyone on co-op this semester or in 10 weeks
+func defaultRule(_ Policy, voter Voter, now time.Time) bool {
+	var active, fallCoop, springCoop bool
+	for _, group := range voter.Groups {
+		if group == "active" {
+			active = true
+		}
+		if group == "fall_coop" {
+			fallCoop = true
+		}
+		if group == "spring_coop" {
+			springCoop = true
+		}
+		if group == "10weeks" {
+			return false
+		}
+	}
+
+	if now.Month() > time.July {
+		return active && !fallCoop
+	} else {
+		return active && !springCoop
+	}
+}
+
+func groupsRule(policy Policy, voter Voter, _ time.Time) bool {
+	member := false
+	for _, group := range voter.Groups {
+		if contains(policy.ExcludedGroups, group) {
+			return false
+		}
+		if contains(policy.Groups, group) {
+			member = true
+		}
+	}
+	return member
+}
+
+func usersRule(policy Policy, voter Voter, _ time.Time) bool {
+	return contains(policy.Users, voter.Username)
+}
+
+func contains(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
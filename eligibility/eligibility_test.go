@@ -0,0 +1,61 @@
+package eligibility
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEligible(t *testing.T) {
+	fall := time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC)
+	spring := time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		voter  Voter
+		now    time.Time
+		want   bool
+	}{
+		{"default active", Policy{}, Voter{"alice", []string{"member", "active"}}, fall, true},
+		{"default inactive", Policy{Kind: KindDefault}, Voter{"alice", []string{"member"}}, fall, false},
+		{"default fall co-op in the fall", Policy{}, Voter{"alice", []string{"active", "fall_coop"}}, fall, false},
+		{"default fall co-op in the spring", Policy{}, Voter{"alice", []string{"active", "fall_coop"}}, spring, true},
+		{"default spring co-op in the spring", Policy{}, Voter{"alice", []string{"active", "spring_coop"}}, spring, false},
+		{"default 10 weeks", Policy{}, Voter{"alice", []string{"active", "10weeks"}}, fall, false},
+		{"everyone", Policy{Kind: KindEveryone}, Voter{"alice", nil}, fall, true},
+		{"groups member", Policy{Kind: KindGroups, Groups: []string{"eboard", "rtp"}}, Voter{"alice", []string{"active", "rtp"}}, fall, true},
+		{"groups non-member", Policy{Kind: KindGroups, Groups: []string{"eboard"}}, Voter{"alice", []string{"active"}}, fall, false},
+		{"groups excluded", Policy{Kind: KindGroups, Groups: []string{"active"}, ExcludedGroups: []string{"10weeks"}}, Voter{"alice", []string{"active", "10weeks"}}, fall, false},
+		{"users listed", Policy{Kind: KindUsers, Users: []string{"alice", "bob"}}, Voter{"bob", nil}, fall, true},
+		{"users not listed", Policy{Kind: KindUsers, Users: []string{"alice"}}, Voter{"bob", []string{"active"}}, fall, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine()
+			engine.Now = func() time.Time { return tt.now }
+			got, err := engine.Eligible(tt.policy, tt.voter)
+			if err != nil {
+				t.Fatalf("Eligible() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eligible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEligibleCustomRule(t *testing.T) {
+	engine := NewEngine()
+	if _, err := engine.Eligible(Policy{Kind: "rtps"}, Voter{}); err == nil {
+		t.Errorf("Eligible() with an unknown kind should fail")
+	}
+
+	engine.Register("rtps", func(_ Policy, voter Voter, _ time.Time) bool {
+		return contains(voter.Groups, "active_rtp")
+	})
+	got, err := engine.Eligible(Policy{Kind: "rtps"}, Voter{"alice", []string{"active_rtp"}})
+	if err != nil || !got {
+		t.Errorf("Eligible() = %v, %v, want true", got, err)
+	}
+}
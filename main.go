@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -12,9 +14,15 @@ import (
 	"time"
 
 	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/authz"
 	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/directory"
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/logging"
 	"github.com/computersciencehouse/vote/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"mvdan.cc/xurls/v2"
 )
@@ -40,23 +48,78 @@ func main() {
 	r.LoadHTMLGlob("templates/*")
 	broker := sse.NewBroker()
 
-	csh := cshAuth.CSHAuth{}
-	csh.Init(
-		os.Getenv("VOTE_OIDC_ID"),
-		os.Getenv("VOTE_OIDC_SECRET"),
-		os.Getenv("VOTE_JWT_SECRET"),
-		os.Getenv("VOTE_STATE"),
-		os.Getenv("VOTE_HOST"),
-		os.Getenv("VOTE_HOST")+"/auth/callback",
-		os.Getenv("VOTE_HOST")+"/auth/login",
-		[]string{"profile", "email", "groups"},
-	)
-
-	r.GET("/auth/login", csh.AuthRequest)
-	r.GET("/auth/callback", csh.AuthCallback)
-	r.GET("/auth/logout", csh.AuthLogout)
-
-	r.GET("/", csh.AuthWrapper(func(c *gin.Context) {
+	// The in-memory store needs no MongoDB, which is handy for tests and demos
+	if os.Getenv("VOTE_STORE") == "memory" {
+		database.SetStore(database.NewMemoryStore())
+	} else {
+		client := database.Connect()
+		database.SetStore(database.NewMongoStore(client))
+		// Instances sharing a database share results through it, so they
+		// can run side by side behind a load balancer
+		if os.Getenv("VOTE_BACKPLANE") == "mongo" {
+			broker.Backplane = database.NewMongoBackplane(client)
+		}
+	}
+
+	// Those viewing a poll are following its turnout, so it is sent again
+	// whenever they come and go
+	broker.Presence = func(topic string) {
+		if primitive.IsValidObjectID(topic) {
+			publishTurnout(context.Background(), broker, topic)
+		}
+	}
+
+	// Without a directory there is no voter roll, and eligibility is checked
+	// as each vote is cast
+	if os.Getenv("VOTE_DIRECTORY_FILE") != "" {
+		members = directory.NewFile(os.Getenv("VOTE_DIRECTORY_FILE"))
+	}
+
+	// Who can do what defaults to how vote has always worked
+	if os.Getenv("VOTE_AUTHZ_FILE") != "" {
+		config, err := authz.LoadConfig(os.Getenv("VOTE_AUTHZ_FILE"))
+		if err != nil {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "main", "method": "main"}).Fatal("error loading permissions")
+		}
+		permissions = authz.New(config)
+	}
+
+	// Development auth needs no OIDC provider, so vote can run offline
+	var auth authenticator
+	if os.Getenv("VOTE_DEV_AUTH") == "true" {
+		logging.Logger.WithFields(logrus.Fields{"module": "main", "method": "main"}).Warn("development auth is on, anyone can log in as anyone")
+		auth = devAuth{}
+		r.POST("/auth/login", auth.AuthRequest)
+	} else {
+		csh := &cshAuth.CSHAuth{}
+		csh.Init(
+			os.Getenv("VOTE_OIDC_ID"),
+			os.Getenv("VOTE_OIDC_SECRET"),
+			os.Getenv("VOTE_JWT_SECRET"),
+			os.Getenv("VOTE_STATE"),
+			os.Getenv("VOTE_HOST"),
+			os.Getenv("VOTE_HOST")+"/auth/callback",
+			os.Getenv("VOTE_HOST")+"/auth/login",
+			[]string{"profile", "email", "groups"},
+		)
+		auth = csh
+	}
+
+	r.GET("/auth/login", auth.AuthRequest)
+	r.GET("/auth/callback", auth.AuthCallback)
+	r.GET("/auth/logout", auth.AuthLogout)
+
+	registerAPI(r, auth, broker)
+	registerTokens(r, auth)
+	registerPages(r, auth, broker)
+
+	serve(r, broker)
+}
+
+// registerPages serves the pages people vote with, and the stream of events
+// about each poll that they follow
+func registerPages(r *gin.Engine, auth authenticator, broker *sse.Broker) {
+	r.GET("/", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
 		// This is intentionally left unprotected
@@ -88,18 +151,39 @@ func main() {
 		})
 		closedPolls = uniquePolls(closedPolls)
 
+		scheduledPolls, err := database.GetScheduledPolls(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		sort.Slice(scheduledPolls, func(i, j int) bool {
+			return scheduledPolls[i].OpensAt.Before(*scheduledPolls[j].OpensAt)
+		})
+
+		draftPolls, err := database.GetDraftPolls(c, claims.UserInfo.Username)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		sort.Slice(draftPolls, func(i, j int) bool {
+			return draftPolls[i].Id > draftPolls[j].Id
+		})
+
 		c.HTML(200, "index.tmpl", gin.H{
-			"Polls":       polls,
-			"ClosedPolls": closedPolls,
-			"Username":    claims.UserInfo.Username,
-			"FullName":    claims.UserInfo.FullName,
+			"Polls":          polls,
+			"DraftPolls":     draftPolls,
+			"ScheduledPolls": scheduledPolls,
+			"ClosedPolls":    closedPolls,
+			"Can":            grantsOn(claims, nil),
+			"Username":       claims.UserInfo.Username,
+			"FullName":       claims.UserInfo.FullName,
 		})
 	}))
 
-	r.GET("/create", csh.AuthWrapper(func(c *gin.Context) {
+	r.GET("/create", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
-		if !canVote(claims.UserInfo.Groups) {
+		if !can(claims, authz.Create, nil) {
 			c.HTML(403, "unauthorized.tmpl", gin.H{
 				"Username": claims.UserInfo.Username,
 				"FullName": claims.UserInfo.FullName,
@@ -107,16 +191,18 @@ func main() {
 			return
 		}
 
-		c.HTML(200, "create.tmpl", gin.H{
-			"Username": claims.UserInfo.Username,
-			"FullName": claims.UserInfo.FullName,
+		renderPollForm(c, claims, &database.Poll{
+			VoteType: database.POLL_TYPE_SIMPLE,
+			TieBreak: database.TIE_BREAK_PREVIOUS_ROUND,
+			Seats:    1,
+			MaxScore: 5,
 		})
 	}))
 
-	r.POST("/create", csh.AuthWrapper(func(c *gin.Context) {
+	r.POST("/create", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
-		if !canVote(claims.UserInfo.Groups) {
+		if !can(claims, authz.Create, nil) {
 			c.HTML(403, "unauthorized.tmpl", gin.H{
 				"Username": claims.UserInfo.Username,
 				"FullName": claims.UserInfo.FullName,
@@ -125,35 +211,28 @@ func main() {
 		}
 
 		poll := &database.Poll{
-			Id:               "",
-			CreatedBy:        claims.UserInfo.Username,
-			ShortDescription: c.PostForm("shortDescription"),
-			LongDescription:  c.PostForm("longDescription"),
-			VoteType:         database.POLL_TYPE_SIMPLE,
-			Open:             true,
-			Hidden:           false,
-			AllowWriteIns:    c.PostForm("allowWriteIn") == "true",
-		}
-		if c.PostForm("rankedChoice") == "true" {
-			poll.VoteType = database.POLL_TYPE_RANKED
-		}
-
-		switch c.PostForm("options") {
-		case "pass-fail-conditional":
-			poll.Options = []string{"Pass", "Fail/Conditional", "Abstain"}
-		case "fail-conditional":
-			poll.Options = []string{"Fail", "Conditional", "Abstain"}
-		case "custom":
-			poll.Options = []string{}
-			for _, opt := range strings.Split(c.PostForm("customOptions"), ",") {
-				poll.Options = append(poll.Options, strings.TrimSpace(opt))
-				if !containsString(poll.Options, "Abstain") && (poll.VoteType == database.POLL_TYPE_SIMPLE) {
-					poll.Options = append(poll.Options, "Abstain")
-				}
+			Id:        "",
+			CreatedBy: claims.UserInfo.Username,
+			Hidden:    false,
+		}
+		if err := parsePollForm(c, poll); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if c.PostForm("draft") == "true" {
+			// Drafts go live when they are published
+			poll.Draft = true
+		} else if err := applySchedule(poll, time.Now()); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if poll.Open {
+			roll, err := takeRoll(c, poll)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
 			}
-		case "pass-fail":
-		default:
-			poll.Options = []string{"Pass", "Fail", "Abstain"}
+			poll.Roll = roll
 		}
 
 		pollId, err := database.CreatePoll(c, poll)
@@ -162,10 +241,14 @@ func main() {
 			return
 		}
 
+		if poll.Scheduled {
+			c.Redirect(302, "/results/"+pollId)
+			return
+		}
 		c.Redirect(302, "/poll/"+pollId)
 	}))
 
-	r.GET("/poll/:id", csh.AuthWrapper(func(c *gin.Context) {
+	r.GET("/poll/:id", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
 		// This is intentionally left unprotected
@@ -177,8 +260,19 @@ func main() {
 			return
 		}
 
+		// Only those who administer a draft can see it, which shows them the
+		// ballot as voters will see it
+		if poll.Draft {
+			if !can(claims, authz.Administer, poll) {
+				c.JSON(404, gin.H{"error": database.ErrPollNotFound.Error()})
+				return
+			}
+			renderPoll(c, claims, poll, 200, ballotForm{})
+			return
+		}
+
 		// If the user can't vote, just show them results
-		if !canVote(claims.UserInfo.Groups) {
+		if !can(claims, authz.Vote, poll) {
 			c.Redirect(302, "/results/"+poll.Id)
 			return
 		}
@@ -198,30 +292,19 @@ func main() {
 			return
 		}
 
-		writeInAdj := 0
-		if poll.AllowWriteIns {
-			writeInAdj = 1
-		}
-
-		canModify := containsString(claims.UserInfo.Groups, "active_rtp") || containsString(claims.UserInfo.Groups, "eboard") || poll.CreatedBy == claims.UserInfo.Username
-
-		c.HTML(200, "poll.tmpl", gin.H{
-			"Id":               poll.Id,
-			"ShortDescription": poll.ShortDescription,
-			"LongDescription":  poll.LongDescription,
-			"Options":          poll.Options,
-			"PollType":         poll.VoteType,
-			"RankedMax":        fmt.Sprint(len(poll.Options) + writeInAdj),
-			"AllowWriteIns":    poll.AllowWriteIns,
-			"CanModify":        canModify,
-			"Username":         claims.UserInfo.Username,
-			"FullName":         claims.UserInfo.FullName,
-		})
+		renderPoll(c, claims, poll, 200, ballotForm{})
 	}))
-	r.POST("/poll/:id", csh.AuthWrapper(func(c *gin.Context) {
+	r.POST("/poll/:id", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
-		if !canVote(claims.UserInfo.Groups) {
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Vote, poll) {
 			c.HTML(403, "unauthorized.tmpl", gin.H{
 				"Username": claims.UserInfo.Username,
 				"FullName": claims.UserInfo.FullName,
@@ -229,106 +312,172 @@ func main() {
 			return
 		}
 
-		poll, err := database.GetPoll(c, c.Param("id"))
+		hasVoted, err := database.HasVoted(c, poll.Id, claims.UserInfo.Username)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-
-		hasVoted, err := database.HasVoted(c, poll.Id, claims.UserInfo.Username)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+		if hasVoted {
+			c.HTML(409, "voted.tmpl", gin.H{
+				"Id":       poll.Id,
+				"Username": claims.UserInfo.Username,
+				"FullName": claims.UserInfo.FullName,
+			})
 			return
 		}
-		if hasVoted || !poll.Open {
+		if !poll.Open {
 			c.Redirect(302, "/results/"+poll.Id)
 			return
 		}
 
-		pId, err := primitive.ObjectIDFromHex(poll.Id)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+		form := ballotForm{
+			Values: make(map[string]string),
+			Errors: make(map[string]string),
 		}
-
-		if poll.VoteType == database.POLL_TYPE_SIMPLE {
-			vote := database.SimpleVote{
-				Id:     "",
-				PollId: pId,
-				Option: c.PostForm("option"),
-			}
-			voter := database.Voter{
-				PollId: pId,
-				UserId: claims.UserInfo.Username,
-			}
-
-			if hasOption(poll, c.PostForm("option")) {
-				vote.Option = c.PostForm("option")
-			} else if poll.AllowWriteIns && c.PostForm("option") == "writein" {
-				vote.Option = c.PostForm("writeinOption")
-			} else {
-				c.JSON(400, gin.H{"error": "Invalid Option"})
-				return
-			}
-			database.CastSimpleVote(c, &vote, &voter)
-		} else if poll.VoteType == database.POLL_TYPE_RANKED {
-			vote := database.RankedVote{
-				Id:      "",
-				PollId:  pId,
-				Options: make(map[string]int),
-			}
-			voter := database.Voter{
-				PollId: pId,
-				UserId: claims.UserInfo.Username,
+		var ballot api.Ballot
+		switch {
+		case poll.VoteType == database.POLL_TYPE_SIMPLE:
+			ballot.Option = c.PostForm("option")
+			if poll.AllowWriteIns && ballot.Option == "writein" {
+				ballot.Option = strings.TrimSpace(c.PostForm("writeinOption"))
 			}
+		case poll.IsRanked():
+			ballot.Ranks = make(map[string]int)
 			for _, opt := range poll.Options {
-				if c.PostForm(opt) != "" {
-					rank, err := strconv.Atoi(c.PostForm(opt))
+				form.Values[opt] = strings.TrimSpace(c.PostForm(opt))
+				if form.Values[opt] == "" {
+					continue
+				}
+				rank, err := strconv.Atoi(form.Values[opt])
+				if err != nil {
+					form.Errors[opt] = "Rank must be a whole number"
+					continue
+				}
+				ballot.Ranks[opt] = rank
+			}
+			if poll.AllowWriteIns {
+				form.Values["writein"] = strings.TrimSpace(c.PostForm("writein"))
+				form.Values["writeinOption"] = strings.TrimSpace(c.PostForm("writeinOption"))
+				writeIn := form.Values["writeinOption"]
+				switch {
+				case form.Values["writein"] == "" && writeIn == "":
+				case form.Values["writein"] == "":
+					form.Errors["writein"] = "Rank your write-in, or leave its name blank"
+				case writeIn == "":
+					form.Errors["writein"] = "Give your write-in a name"
+				case hasOption(poll, writeIn):
+					form.Errors["writein"] = "Your write-in is already an option"
+				default:
+					rank, err := strconv.Atoi(form.Values["writein"])
 					if err != nil {
-						c.JSON(500, gin.H{"error": "error parsing votes"})
-					}
-					if rank > 0 {
-						vote.Options[opt] = rank
+						form.Errors["writein"] = "Rank must be a whole number"
+					} else {
+						ballot.Ranks[writeIn] = rank
 					}
 				}
 			}
-			if c.PostForm("writeinOption") != "" && c.PostForm("writein") != "" {
-				for candidate := range vote.Options {
-					if strings.EqualFold(candidate, strings.TrimSpace(c.PostForm("writeinOption"))) {
-						c.JSON(500, gin.H{"error": "write-in is already an option"})
-						return
-					}
+		case poll.VoteType == database.POLL_TYPE_APPROVAL:
+			for _, opt := range c.PostFormArray("option") {
+				form.Values[opt] = "on"
+				if opt != "writein" {
+					ballot.Approved = append(ballot.Approved, opt)
+				}
+			}
+			if poll.AllowWriteIns {
+				form.Values["writeinOption"] = strings.TrimSpace(c.PostForm("writeinOption"))
+				writeIn := form.Values["writeinOption"]
+				switch {
+				case form.Values["writein"] == "":
+				case writeIn == "":
+					form.Errors["writein"] = "Give your write-in a name"
+				case hasOption(poll, writeIn):
+					form.Errors["writein"] = "Your write-in is already an option"
+				default:
+					ballot.Approved = append(ballot.Approved, writeIn)
 				}
-				rank, err := strconv.Atoi(c.PostForm("writein"))
+			}
+		case poll.VoteType == database.POLL_TYPE_SCORE || poll.VoteType == database.POLL_TYPE_STAR:
+			ballot.Scores = make(map[string]int)
+			for _, opt := range poll.Options {
+				form.Values[opt] = strings.TrimSpace(c.PostForm(opt))
+				if form.Values[opt] == "" {
+					continue
+				}
+				score, err := strconv.Atoi(form.Values[opt])
 				if err != nil {
-					c.JSON(500, gin.H{"error": "error parsing votes"})
+					form.Errors[opt] = "Score must be a whole number"
+					continue
 				}
-				if rank > 0 {
-					vote.Options[c.PostForm("writeinOption")] = rank
+				ballot.Scores[opt] = score
+			}
+			if poll.AllowWriteIns {
+				form.Values["writein"] = strings.TrimSpace(c.PostForm("writein"))
+				form.Values["writeinOption"] = strings.TrimSpace(c.PostForm("writeinOption"))
+				writeIn := form.Values["writeinOption"]
+				switch {
+				case form.Values["writein"] == "" && writeIn == "":
+				case form.Values["writein"] == "":
+					form.Errors["writein"] = "Score your write-in, or leave its name blank"
+				case writeIn == "":
+					form.Errors["writein"] = "Give your write-in a name"
+				case hasOption(poll, writeIn):
+					form.Errors["writein"] = "Your write-in is already an option"
+				default:
+					score, err := strconv.Atoi(form.Values["writein"])
+					if err != nil {
+						form.Errors["writein"] = "Score must be a whole number"
+					} else {
+						ballot.Scores[writeIn] = score
+					}
 				}
 			}
-			database.CastRankedVote(c, &vote, &voter)
-		} else {
+		default:
 			c.JSON(500, gin.H{"error": "Unknown Poll Type"})
 			return
 		}
 
-		if poll, err := database.GetPoll(c, c.Param("id")); err == nil {
-			if results, err := poll.GetResult(c); err == nil {
-				if bytes, err := json.Marshal(results); err == nil {
-					broker.Notifier <- sse.NotificationEvent{
-						EventName: poll.Id,
-						Payload:   string(bytes),
+		if len(form.Errors) == 0 {
+			err = castBallot(c, poll, claims.UserInfo.Username, ballot)
+			var ballotErr *database.BallotError
+			if errors.As(err, &ballotErr) {
+				form.Error = ballotErr.Message
+				for choice, message := range ballotErr.Fields {
+					switch {
+					case poll.VoteType == database.POLL_TYPE_SIMPLE:
+						// A simple ballot has nowhere to show a field's error
+						form.Error = message
+					case hasOption(poll, choice):
+						form.Errors[choice] = message
+					default:
+						form.Errors["writein"] = message
 					}
 				}
-
 			}
 		}
+		if form.Error != "" || len(form.Errors) > 0 {
+			renderPoll(c, claims, poll, 400, form)
+			return
+		}
+		if errors.Is(err, database.ErrAlreadyVoted) {
+			c.HTML(409, "voted.tmpl", gin.H{
+				"Id":       poll.Id,
+				"Username": claims.UserInfo.Username,
+				"FullName": claims.UserInfo.FullName,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		publishResults(c, broker, poll.Id)
+		publishTurnout(c, broker, poll.Id)
 
 		c.Redirect(302, "/results/"+poll.Id)
 	}))
 
-	r.GET("/results/:id", csh.AuthWrapper(func(c *gin.Context) {
+	r.GET("/results/:id", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
 		// This is intentionally left unprotected
@@ -340,7 +489,17 @@ func main() {
 			return
 		}
 
-		if poll.Hidden && poll.CreatedBy != claims.UserInfo.Username {
+		if poll.Draft {
+			if !can(claims, authz.Administer, poll) {
+				c.JSON(404, gin.H{"error": database.ErrPollNotFound.Error()})
+				return
+			}
+			c.Redirect(302, "/poll/"+poll.Id)
+			return
+		}
+
+		grants := grantsOn(claims, poll)
+		if poll.Hidden && !grants.Has(authz.ViewHidden) {
 			c.HTML(403, "hidden.tmpl", gin.H{
 				"Username": claims.UserInfo.Username,
 				"FullName": claims.UserInfo.FullName,
@@ -354,7 +513,25 @@ func main() {
 			return
 		}
 
-		canModify := containsString(claims.UserInfo.Groups, "active_rtp") || containsString(claims.UserInfo.Groups, "eboard") || poll.CreatedBy == claims.UserInfo.Username
+		turnout, err := pollTurnout(c, poll)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		// A percentage can only be measured against a roll
+		percent := 0.0
+		if turnout.Eligible > 0 {
+			percent = float64(turnout.Voted) * 100 / float64(turnout.Eligible)
+		}
+
+		canEdit := false
+		if grants.Has(authz.Administer) {
+			canEdit, err = poll.Editable(c)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
 
 		c.HTML(200, "result.tmpl", gin.H{
 			"Id":               poll.Id,
@@ -363,14 +540,22 @@ func main() {
 			"VoteType":         poll.VoteType,
 			"Results":          results,
 			"IsOpen":           poll.Open,
+			"IsScheduled":      poll.Scheduled,
+			"OpensAt":          poll.OpensAt,
+			"ClosesAt":         poll.ClosesAt,
 			"IsHidden":         poll.Hidden,
-			"CanModify":        canModify,
+			"Can":              grants,
+			"CanEdit":          canEdit,
+			"HasRoll":          poll.Roll != nil,
+			"Voted":            turnout.Voted,
+			"RollSize":         turnout.Eligible,
+			"Turnout":          percent,
 			"Username":         claims.UserInfo.Username,
 			"FullName":         claims.UserInfo.FullName,
 		})
 	}))
 
-	r.POST("/poll/:id/hide", csh.AuthWrapper(func(c *gin.Context) {
+	r.POST("/poll/:id/hide", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
 
@@ -381,8 +566,8 @@ func main() {
 			return
 		}
 
-		if poll.CreatedBy != claims.UserInfo.Username {
-			c.JSON(403, gin.H{"error": "Only the creator can hide a poll result"})
+		if !can(claims, authz.Hide, poll) {
+			c.JSON(403, gin.H{"error": "You cannot hide this poll's results."})
 			return
 		}
 
@@ -408,7 +593,7 @@ func main() {
 		c.Redirect(302, "/results/"+poll.Id)
 	}))
 
-	r.POST("/poll/:id/reveal", csh.AuthWrapper(func(c *gin.Context) {
+	r.POST("/poll/:id/reveal", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
 
@@ -419,8 +604,8 @@ func main() {
 			return
 		}
 
-		if poll.CreatedBy != claims.UserInfo.Username {
-			c.JSON(403, gin.H{"error": "Only the creator can reveal a poll result"})
+		if !can(claims, authz.Reveal, poll) {
+			c.JSON(403, gin.H{"error": "You cannot reveal this poll's results."})
 			return
 		}
 
@@ -446,11 +631,9 @@ func main() {
 		c.Redirect(302, "/results/"+poll.Id)
 	}))
 
-	r.POST("/poll/:id/close", csh.AuthWrapper(func(c *gin.Context) {
+	r.POST("/poll/:id/tiebreak", auth.AuthWrapper(func(c *gin.Context) {
 		cl, _ := c.Get("cshauth")
 		claims := cl.(cshAuth.CSHClaims)
-		// This is intentionally left unprotected
-		// A user should be able to end their own polls, regardless of if they can vote
 
 		poll, err := database.GetPoll(c, c.Param("id"))
 
@@ -459,15 +642,276 @@ func main() {
 			return
 		}
 
-		if poll.CreatedBy != claims.UserInfo.Username {
-			if containsString(claims.UserInfo.Groups, "active_rtp") || containsString(claims.UserInfo.Groups, "eboard") {
-			} else {
-				c.JSON(403, gin.H{"error": "You cannot end this poll."})
+		if !can(claims, authz.Administer, poll) {
+			c.JSON(403, gin.H{"error": "You cannot break ties in this poll."})
+			return
+		}
+		if poll.TieBreak != database.TIE_BREAK_CREATOR {
+			c.JSON(400, gin.H{"error": "Ties in this poll are not broken by the creator"})
+			return
+		}
+		// Later ballots could change which options are tied
+		if poll.Open || poll.Scheduled || poll.Draft {
+			c.JSON(409, gin.H{"error": "Ties can only be broken once voting has ended."})
+			return
+		}
+
+		results, err := poll.GetResult(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		candidate := c.PostForm("eliminate")
+		if !containsString(results.Pending, candidate) {
+			c.JSON(400, gin.H{"error": "That option is not tied for last place"})
+			return
+		}
+
+		err = poll.AddTieBreakDecision(c, candidate)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		pId, _ := primitive.ObjectIDFromHex(poll.Id)
+		action := database.Action{
+			Id:     "",
+			PollId: pId,
+			Date:   primitive.NewDateTimeFromTime(time.Now()),
+			User:   claims.UserInfo.Username,
+			Action: "Break Tie: Eliminate " + candidate,
+		}
+		err = database.WriteAction(c, &action)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		publishResults(c, broker, poll.Id)
+
+		c.Redirect(302, "/results/"+poll.Id)
+	}))
+
+	r.GET("/poll/:id/voters", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Administer, poll) {
+			c.JSON(403, gin.H{"error": "You cannot see who hasn't voted in this poll."})
+			return
+		}
+
+		notVoted, err := poll.NotVoted(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.HTML(200, "voters.tmpl", gin.H{
+			"Id":               poll.Id,
+			"ShortDescription": poll.ShortDescription,
+			"Roll":             poll.Roll,
+			"NotVoted":         notVoted,
+			"Username":         claims.UserInfo.Username,
+			"FullName":         claims.UserInfo.FullName,
+		})
+	}))
+
+	r.GET("/poll/:id/edit", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Administer, poll) {
+			c.JSON(403, gin.H{"error": "You cannot edit this poll."})
+			return
+		}
+		editable, err := poll.Editable(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !editable {
+			c.JSON(409, gin.H{"error": "This poll can't be edited once it has closed or someone has voted."})
+			return
+		}
+
+		renderPollForm(c, claims, poll)
+	}))
+
+	r.POST("/poll/:id/edit", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Administer, poll) {
+			c.JSON(403, gin.H{"error": "You cannot edit this poll."})
+			return
+		}
+		editable, err := poll.Editable(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !editable {
+			c.JSON(409, gin.H{"error": "This poll can't be edited once it has closed or someone has voted."})
+			return
+		}
+
+		wasOpen := poll.Open
+		if err := parsePollForm(c, poll); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if !poll.Draft {
+			if err := applySchedule(poll, time.Now()); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
 				return
 			}
 		}
+		// Nobody has voted yet, so the roll is taken again in case who can
+		// vote has changed
+		poll.Roll = nil
+		if poll.Open {
+			roll, err := takeRoll(c, poll)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			poll.Roll = roll
+		}
+
+		err = poll.Update(c)
+		if errors.Is(err, database.ErrPollHasVotes) {
+			// Someone voted after the poll was checked above
+			c.JSON(409, gin.H{"error": "This poll can't be edited once it has closed or someone has voted."})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		pId, _ := primitive.ObjectIDFromHex(poll.Id)
+		action := database.Action{
+			Id:     "",
+			PollId: pId,
+			Date:   primitive.NewDateTimeFromTime(time.Now()),
+			User:   claims.UserInfo.Username,
+			Action: "Edit Poll",
+		}
+		err = database.WriteAction(c, &action)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if poll.Open != wasOpen {
+			publishState(broker, poll.Id, poll.Open)
+		}
+
+		if poll.Scheduled {
+			c.Redirect(302, "/results/"+poll.Id)
+			return
+		}
+		c.Redirect(302, "/poll/"+poll.Id)
+	}))
+
+	r.POST("/poll/:id/publish", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Administer, poll) {
+			c.JSON(403, gin.H{"error": "You cannot publish this poll."})
+			return
+		}
+		if !poll.Draft {
+			c.Redirect(302, "/poll/"+poll.Id)
+			return
+		}
+
+		if err := applySchedule(poll, time.Now()); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		poll.Draft = false
+		if poll.Open {
+			roll, err := takeRoll(c, poll)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			poll.Roll = roll
+		}
+
+		err = poll.Update(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		pId, _ := primitive.ObjectIDFromHex(poll.Id)
+		action := database.Action{
+			Id:     "",
+			PollId: pId,
+			Date:   primitive.NewDateTimeFromTime(time.Now()),
+			User:   claims.UserInfo.Username,
+			Action: "Publish Poll",
+		}
+		err = database.WriteAction(c, &action)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if poll.Scheduled {
+			c.Redirect(302, "/results/"+poll.Id)
+			return
+		}
+		c.Redirect(302, "/poll/"+poll.Id)
+	}))
+
+	r.POST("/poll/:id/close", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+		// This is intentionally left unprotected
+		// A user should be able to end their own polls, regardless of if they can vote
+
+		poll, err := database.GetPoll(c, c.Param("id"))
+
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !can(claims, authz.Close, poll) {
+			c.JSON(403, gin.H{"error": "You cannot end this poll."})
+			return
+		}
 
 		err = poll.Close(c)
+		if errors.Is(err, database.ErrPollClosed) {
+			c.Redirect(302, "/results/"+poll.Id)
+			return
+		}
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -485,39 +929,223 @@ func main() {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		publishState(broker, poll.Id, false)
 
 		c.Redirect(302, "/results/"+poll.Id)
 	}))
 
-	r.GET("/stream/:topic", csh.AuthWrapper(broker.ServeHTTP))
+	// Scripts can follow results with an API token as well as the session.
+	// The results of a hidden poll are only streamed to those who can see
+	// them, though anyone can follow its state and turnout.
+	r.GET("/stream/:topic", apiAuth(auth, api.ScopeResultsRead, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
 
-	go broker.Listen()
+		poll, err := database.GetPoll(c, c.Param("topic"))
+		if err != nil && !errors.Is(err, database.ErrPollNotFound) {
+			apiError(c, 500, err.Error())
+			return
+		}
+		if poll != nil && poll.Hidden && !can(claims, authz.ViewHidden, poll) {
+			broker.Serve(c, func(event sse.NotificationEvent) bool {
+				return event.EventName != api.EventResults
+			})
+			return
+		}
 
-	r.Run()
+		broker.ServeHTTP(c)
+	}))
 }
 
-func canVote(groups []string) bool {
-	var active, fallCoop, springCoop bool
-	for _, group := range groups {
-		if group == "active" {
-			active = true
+// ballotForm is a submitted ballot being shown back to the voter, with the
+// problems that stopped it from being cast
+type ballotForm struct {
+	// Values are the submitted form fields
+	Values map[string]string
+	// Errors maps form fields to what is wrong with them
+	Errors map[string]string
+	// Error is a problem with the ballot as a whole
+	Error string
+}
+
+func renderPoll(c *gin.Context, claims cshAuth.CSHClaims, poll *database.Poll, status int, form ballotForm) {
+	if form.Values == nil {
+		form.Values = make(map[string]string)
+	}
+	if form.Errors == nil {
+		form.Errors = make(map[string]string)
+	}
+
+	turnout, err := pollTurnout(c, poll)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(status, "poll.tmpl", gin.H{
+		"Id":               poll.Id,
+		"ShortDescription": poll.ShortDescription,
+		"LongDescription":  poll.LongDescription,
+		"Options":          poll.Options,
+		"PollType":         poll.VoteType,
+		"Ranked":           poll.IsRanked(),
+		"RankedMax":        fmt.Sprint(poll.RankedMax()),
+		"Seats":            poll.Seats,
+		"MaxScore":         poll.MaxScore,
+		"AllowWriteIns":    poll.AllowWriteIns,
+		"ClosesAt":         poll.ClosesAt,
+		"Can":              grantsOn(claims, poll),
+		"Preview":          poll.Draft,
+		"Voted":            turnout.Voted,
+		"RollSize":         turnout.Eligible,
+		"Values":           form.Values,
+		"Errors":           form.Errors,
+		"Error":            form.Error,
+		"Username":         claims.UserInfo.Username,
+		"FullName":         claims.UserInfo.FullName,
+	})
+}
+
+// publishResults sends the latest results of a poll to anyone watching them.
+// Every event about a poll is sent on the topic of its id, so a page follows
+// it with one stream.
+func publishResults(ctx context.Context, broker *sse.Broker, pollId string) {
+	if poll, err := database.GetPoll(ctx, pollId); err == nil {
+		if results, err := poll.GetResult(ctx); err == nil {
+			if bytes, err := json.Marshal(results); err == nil {
+				broker.Notifier <- sse.NotificationEvent{
+					Topic:     poll.Id,
+					EventName: api.EventResults,
+					Payload:   string(bytes),
+				}
+			}
 		}
-		if group == "fall_coop" {
-			fallCoop = true
+	}
+}
+
+// publishState tells anyone watching a poll that it has opened or closed
+func publishState(broker *sse.Broker, pollId string, open bool) {
+	if bytes, err := json.Marshal(gin.H{"open": open}); err == nil {
+		broker.Notifier <- sse.NotificationEvent{
+			Topic:     pollId,
+			EventName: api.EventState,
+			Payload:   string(bytes),
 		}
-		if group == "spring_coop" {
-			springCoop = true
+	}
+}
+
+// publishTurnout tells anyone watching a poll how many have voted and how
+// many are viewing it. Viewers are counted by the instance publishing, so
+// with several instances the count is of those connected to whichever
+// published last.
+func publishTurnout(ctx context.Context, broker *sse.Broker, pollId string) {
+	if poll, err := database.GetPoll(ctx, pollId); err == nil {
+		if turnout, err := pollTurnout(ctx, poll); err == nil {
+			turnout.Viewing = broker.Clients(poll.Id)
+			if bytes, err := json.Marshal(turnout); err == nil {
+				broker.Notifier <- sse.NotificationEvent{
+					Topic:     poll.Id,
+					EventName: api.EventTurnout,
+					Payload:   string(bytes),
+				}
+			}
+		}
+	}
+}
+
+// pollTurnout counts who has voted in a poll, against its roll if it has one
+func pollTurnout(ctx context.Context, poll *database.Poll) (api.Turnout, error) {
+	voted, err := database.CountVoters(ctx, poll.Id)
+	if err != nil {
+		return api.Turnout{}, err
+	}
+	turnout := api.Turnout{PollId: poll.Id, Voted: voted}
+	if poll.Roll != nil {
+		turnout.Eligible = len(poll.Roll.Voters)
+	}
+	return turnout, nil
+}
+
+// voters decides who can vote in each poll
+var voters eligibility.Engine = eligibility.NewEngine()
+
+// members is the directory voter rolls are taken from, if there is one
+var members directory.Directory
+
+// takeRoll lists everyone in the directory who is eligible to vote in the
+// poll right now. There is no roll without a directory.
+func takeRoll(ctx context.Context, poll *database.Poll) (*database.VoterRoll, error) {
+	if members == nil {
+		return nil, nil
+	}
+	all, err := members.Members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roll := &database.VoterRoll{TakenAt: time.Now(), Voters: []string{}}
+	for _, member := range all {
+		eligible, err := voters.Eligible(poll.Eligibility, eligibility.Voter{
+			Username: member.Username,
+			Groups:   member.Groups,
+		})
+		if err != nil {
+			return nil, err
 		}
-		if group == "10weeks" {
-			return false
+		if eligible {
+			roll.Voters = append(roll.Voters, member.Username)
 		}
 	}
+	sort.Strings(roll.Voters)
+	return roll, nil
+}
 
-	if time.Now().Month() > time.July {
-		return active && !fallCoop
-	} else {
-		return active && !springCoop
+// permissions decides what users can do
+var permissions = authz.New(authz.DefaultConfig())
+
+// can reports whether the user has permission on poll, or on no poll in
+// particular if it is nil
+func can(claims cshAuth.CSHClaims, permission authz.Permission, poll *database.Poll) bool {
+	return grantsOn(claims, poll).Has(permission)
+}
+
+// grantsOn lists everything the user can do to poll, or without a poll if it
+// is nil
+func grantsOn(claims cshAuth.CSHClaims, poll *database.Poll) authz.Grants {
+	user := authz.User{
+		Username: claims.UserInfo.Username,
+		Groups:   claims.UserInfo.Groups,
+	}
+	if poll == nil {
+		// Without a poll, eligibility is decided by the default policy
+		return permissions.Grants(user, authz.Poll{Eligible: canVote(claims, eligibility.Policy{})})
+	}
+	return permissions.Grants(user, authz.Poll{
+		CreatedBy: poll.CreatedBy,
+		Eligible:  canVoteIn(claims, poll),
+	})
+}
+
+// canVoteIn reports whether the user is eligible to vote in the poll, going
+// by its roll if it has one
+func canVoteIn(claims cshAuth.CSHClaims, poll *database.Poll) bool {
+	if poll.Roll != nil {
+		return containsString(poll.Roll.Voters, claims.UserInfo.Username)
+	}
+	return canVote(claims, poll.Eligibility)
+}
+
+// canVote reports whether the user is eligible under policy
+func canVote(claims cshAuth.CSHClaims, policy eligibility.Policy) bool {
+	eligible, err := voters.Eligible(policy, eligibility.Voter{
+		Username: claims.UserInfo.Username,
+		Groups:   claims.UserInfo.Groups,
+	})
+	if err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "main", "method": "canVote"}).Error("error checking eligibility")
+		return false
 	}
+	return eligible
 }
 
 func uniquePolls(polls []*database.Poll) []*database.Poll {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer serves every route like main does, with development auth and
+// the empty in-memory store it returns
+func newTestServer(t *testing.T) (*gin.Engine, *database.MemoryStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := database.NewMemoryStore()
+	database.SetStore(store)
+
+	r := gin.New()
+	r.SetFuncMap(template.FuncMap{
+		"inc":       inc,
+		"MakeLinks": MakeLinks,
+	})
+	r.LoadHTMLGlob("templates/*")
+	broker := sse.NewBroker()
+	go broker.Listen(t.Context())
+
+	auth := devAuth{}
+	registerAPI(r, auth, broker)
+	registerTokens(r, auth)
+	registerPages(r, auth, broker)
+	return r, store
+}
+
+// loggedIn is the cookie of a user logged in with development auth
+func loggedIn(t *testing.T, username string, groups ...string) *http.Cookie {
+	t.Helper()
+	value, err := encodeDevUser(cshAuth.CSHUserInfo{Username: username, FullName: username, Groups: groups})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: cshAuth.CookieName, Value: value}
+}
+
+// postForm posts form to path as the user with cookie
+func postForm(r *gin.Engine, cookie *http.Cookie, path string, form url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	return w
+}
+
+// createPoll stores an open poll and returns its id
+func createPoll(t *testing.T, poll *database.Poll) string {
+	t.Helper()
+	poll.Open = true
+	if poll.CreatedBy == "" {
+		poll.CreatedBy = "chair"
+	}
+	id, err := database.CreatePoll(context.Background(), poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestCastBallotPage(t *testing.T) {
+	r, _ := newTestServer(t)
+	alice := loggedIn(t, "alice", "active")
+
+	simple := createPoll(t, &database.Poll{
+		VoteType: database.POLL_TYPE_SIMPLE,
+		Options:  []string{"Pass", "Fail", "Abstain"},
+	})
+	w := postForm(r, alice, "/poll/"+simple, url.Values{"option": {"Pass"}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/results/"+simple {
+		t.Fatalf("first vote got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	// Voting again is refused, and says why
+	w = postForm(r, alice, "/poll/"+simple, url.Values{"option": {"Fail"}})
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "already voted") {
+		t.Errorf("second vote got %d %s", w.Code, w.Body.String())
+	}
+	if voters, _ := database.CountVoters(context.Background(), simple); voters != 1 {
+		t.Errorf("%d voters recorded, want 1", voters)
+	}
+
+	// An invalid ballot is shown back with its problems, and not cast
+	ranked := createPoll(t, &database.Poll{
+		VoteType: database.POLL_TYPE_RANKED,
+		Options:  []string{"Pizza", "Tacos", "Sushi"},
+	})
+	w = postForm(r, alice, "/poll/"+ranked, url.Values{"Pizza": {"1"}, "Tacos": {"1"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Rank 1 is given to more than one option") {
+		t.Errorf("invalid ballot got %d %s", w.Code, w.Body.String())
+	}
+	if voted, _ := database.HasVoted(context.Background(), ranked, "alice"); voted {
+		t.Error("an invalid ballot was cast")
+	}
+}
+
+// invalidInputs lists the names of the inputs in page marked invalid
+func invalidInputs(page string) []string {
+	var names []string
+	for _, input := range regexp.MustCompile(`<input[^>]*>`).FindAllString(page, -1) {
+		if !strings.Contains(input, "is-invalid") {
+			continue
+		}
+		if name := regexp.MustCompile(`name="([^"]*)"`).FindStringSubmatch(input); name != nil {
+			names = append(names, name[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRankedBallotForm(t *testing.T) {
+	r, store := newTestServer(t)
+	id := createPoll(t, &database.Poll{
+		VoteType:      database.POLL_TYPE_RANKED,
+		Options:       []string{"Pizza", "Tacos", "Sushi"},
+		AllowWriteIns: true,
+	})
+
+	tests := []struct {
+		name string
+		form url.Values
+		// invalid are the inputs the problems are shown beside
+		invalid []string
+		message string
+	}{
+		{"not a number", url.Values{"Pizza": {"first"}, "Tacos": {"2"}}, []string{"Pizza"}, "Rank must be a whole number"},
+		{"duplicate ranks", url.Values{"Pizza": {"1"}, "Tacos": {"1"}}, []string{"Pizza", "Tacos"}, "Rank 1 is given to more than one option"},
+		{"above the highest rank", url.Values{"Pizza": {"1"}, "Tacos": {"5"}}, []string{"Tacos"}, "Rank must be between 1 and 4"},
+		{"zero", url.Values{"Pizza": {"0"}}, []string{"Pizza"}, "Rank must be between 1 and 4"},
+		{"negative", url.Values{"Pizza": {"1"}, "Sushi": {"-1"}}, []string{"Sushi"}, "Rank must be between 1 and 4"},
+		{"write-in without a name", url.Values{"Pizza": {"1"}, "writein": {"2"}}, []string{"writein"}, "Give your write-in a name"},
+		{"write-in that is an option", url.Values{"writein": {"1"}, "writeinOption": {" pizza "}}, []string{"writein"}, "Your write-in is already an option"},
+		{"write-in too low", url.Values{"Pizza": {"1"}, "writein": {"0"}, "writeinOption": {"Ramen"}}, []string{"writein"}, "Rank must be between 1 and 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postForm(r, loggedIn(t, "alice", "active"), "/poll/"+id, tt.form)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("got %d, want 400", w.Code)
+			}
+			if got := invalidInputs(w.Body.String()); !reflect.DeepEqual(got, tt.invalid) {
+				t.Errorf("invalid inputs = %v, want %v", got, tt.invalid)
+			}
+			if !strings.Contains(w.Body.String(), tt.message) {
+				t.Errorf("page doesn't say %q", tt.message)
+			}
+		})
+	}
+
+	// Gaps are closed up before the ballot is stored
+	w := postForm(r, loggedIn(t, "bob", "active"), "/poll/"+id, url.Values{"Pizza": {"4"}, "Sushi": {"2"}, "writein": {"3"}, "writeinOption": {"Ramen"}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("valid ballot got %d %s", w.Code, w.Body.String())
+	}
+	votes, err := store.GetRankedVotes(context.Background(), id)
+	if want := map[string]int{"Sushi": 1, "Ramen": 2, "Pizza": 3}; err != nil || len(votes) != 1 || !reflect.DeepEqual(votes[0].Options, want) {
+		t.Errorf("stored %+v, %v, want ranks %v", votes, err, want)
+	}
+}
+
+// TestCustomOptions creates polls with custom options through the form
+func TestCustomOptions(t *testing.T) {
+	r, store := newTestServer(t)
+	chair := loggedIn(t, "chair", "active")
+
+	tests := []struct {
+		name     string
+		voteType string
+		options  string
+		// want is the poll's options, or nil if the form is rejected
+		want  []string
+		error string
+	}{
+		{"trimmed", "simple", " Pizza ,Sushi,  Tacos", []string{"Pizza", "Sushi", "Tacos", "Abstain"}, ""},
+		{"abstain given", "simple", "Pizza, Abstain, Sushi", []string{"Pizza", "Abstain", "Sushi"}, ""},
+		{"ranked", "ranked", "Pizza, Sushi", []string{"Pizza", "Sushi"}, ""},
+		{"empty", "simple", "", nil, "Every option needs a name"},
+		{"blank option", "simple", "Pizza, , Sushi", nil, "Every option needs a name"},
+		{"trailing comma", "simple", "Pizza, Sushi,", nil, "Every option needs a name"},
+		{"duplicate", "simple", "Pizza, Sushi, Pizza ", nil, `\"Pizza\" is an option more than once`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := postForm(r, chair, "/create", url.Values{
+				"shortDescription": {"Lunch"},
+				"voteType":         {test.voteType},
+				"options":          {"custom"},
+				"customOptions":    {test.options},
+				"eligibility":      {"everyone"},
+			})
+			if test.want == nil {
+				if w.Code != 400 || !strings.Contains(w.Body.String(), test.error) {
+					t.Fatalf("got %d %s, want 400 %s", w.Code, w.Body.String(), test.error)
+				}
+				return
+			}
+			if w.Code != 302 {
+				t.Fatalf("got %d %s, want a redirect", w.Code, w.Body.String())
+			}
+			poll, err := store.GetPoll(context.Background(), strings.TrimPrefix(w.Header().Get("Location"), "/poll/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(poll.Options, test.want) {
+				t.Errorf("got options %q, want %q", poll.Options, test.want)
+			}
+		})
+	}
+}
+
+// TestQuorumOfRoll shows a quorum measured against the voter roll
+func TestQuorumOfRoll(t *testing.T) {
+	r, _ := newTestServer(t)
+	alice := loggedIn(t, "alice", "active")
+
+	id := createPoll(t, &database.Poll{
+		VoteType:      database.POLL_TYPE_SIMPLE,
+		Options:       []string{"Pass", "Fail", "Abstain"},
+		Threshold:     database.THRESHOLD_MAJORITY,
+		QuorumPercent: 50,
+		Roll:          &database.VoterRoll{Voters: []string{"alice", "bob", "carol", "dave", "erin"}},
+	})
+	postForm(r, alice, "/poll/"+id, url.Values{"option": {"Pass"}})
+
+	request := httptest.NewRequest("GET", "/results/"+id, nil)
+	request.AddCookie(alice)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	for _, want := range []string{"NO QUORUM", "1 of the 3 voter(s) needed for quorum voted.", "Quorum is 50% of the 5 eligible voter(s), rounded up."} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("results don't say %q", want)
+		}
+	}
+}
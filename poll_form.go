@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/tally"
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleLayout is the format of the datetime-local inputs used to schedule
+// a poll, which are in the server's time zone
+const scheduleLayout = "2006-01-02T15:04"
+
+// parsePollForm sets the description, options, voting method and settings
+// of poll from the create and edit form. The error explains which field is
+// wrong.
+func parsePollForm(c *gin.Context, poll *database.Poll) error {
+	settings := api.PollSettings{
+		ShortDescription: c.PostForm("shortDescription"),
+		LongDescription:  c.PostForm("longDescription"),
+		VoteType:         c.PostForm("voteType"),
+		AllowWriteIns:    c.PostForm("allowWriteIn") == "true",
+		Eligibility:      eligibility.Policy{Kind: eligibility.Kind(c.PostForm("eligibility"))},
+	}
+
+	switch settings.VoteType {
+	case database.POLL_TYPE_RANKED, database.POLL_TYPE_STV:
+		settings.TieBreak = c.PostForm("tieBreak")
+	case database.POLL_TYPE_CONDORCET, database.POLL_TYPE_APPROVAL, database.POLL_TYPE_SCORE, database.POLL_TYPE_STAR:
+	default:
+		settings.VoteType = database.POLL_TYPE_SIMPLE
+	}
+	if settings.VoteType == database.POLL_TYPE_STV {
+		// A blank or mistyped number is left as 0 seats, which is rejected
+		settings.Seats, _ = strconv.Atoi(c.PostForm("seats"))
+	}
+	if settings.VoteType == database.POLL_TYPE_SCORE || settings.VoteType == database.POLL_TYPE_STAR {
+		settings.MaxScore, _ = strconv.Atoi(c.PostForm("maxScore"))
+	}
+	settings.Threshold = c.PostForm("threshold")
+	settings.Motion = strings.TrimSpace(c.PostForm("motion"))
+	settings.CountAbstain = c.PostForm("countAbstain") == "true"
+	if c.PostForm("quorum") != "" {
+		quorum, err := strconv.Atoi(c.PostForm("quorum"))
+		if err != nil {
+			return errors.New("Quorum must be a number of voters")
+		}
+		settings.Quorum = quorum
+	}
+	if c.PostForm("quorumPercent") != "" {
+		percent, err := strconv.Atoi(c.PostForm("quorumPercent"))
+		if err != nil {
+			return errors.New("Quorum must be a percentage of the voter roll")
+		}
+		settings.QuorumPercent = percent
+	}
+
+	if c.PostForm("options") == "custom" {
+		settings.Options = []string{}
+		for _, opt := range strings.Split(c.PostForm("customOptions"), ",") {
+			opt = strings.TrimSpace(opt)
+			if opt == "" {
+				return errors.New("Every option needs a name")
+			}
+			if containsString(settings.Options, opt) {
+				return fmt.Errorf("%q is an option more than once", opt)
+			}
+			settings.Options = append(settings.Options, opt)
+		}
+		if !containsString(settings.Options, "Abstain") && (settings.VoteType == database.POLL_TYPE_SIMPLE) {
+			settings.Options = append(settings.Options, "Abstain")
+		}
+	} else if preset, ok := api.OptionPresets[c.PostForm("options")]; ok {
+		settings.Options = append([]string(nil), preset...)
+	} else {
+		settings.Options = append([]string(nil), api.OptionPresets["pass-fail"]...)
+	}
+
+	switch settings.Eligibility.Kind {
+	case eligibility.KindGroups:
+		settings.Eligibility.Groups = splitList(c.PostForm("eligibleGroups"))
+		settings.Eligibility.ExcludedGroups = splitList(c.PostForm("excludedGroups"))
+	case eligibility.KindUsers:
+		settings.Eligibility.Users = splitList(c.PostForm("eligibleUsers"))
+	}
+
+	if c.PostForm("opensAt") != "" {
+		opensAt, err := time.ParseInLocation(scheduleLayout, c.PostForm("opensAt"), time.Local)
+		if err != nil {
+			return errors.New("Invalid opening time")
+		}
+		settings.OpensAt = &opensAt
+	}
+	if c.PostForm("closesAt") != "" {
+		closesAt, err := time.ParseInLocation(scheduleLayout, c.PostForm("closesAt"), time.Local)
+		if err != nil {
+			return errors.New("Invalid closing time")
+		}
+		settings.ClosesAt = &closesAt
+	}
+
+	return applyPollSettings(poll, settings)
+}
+
+// applyPollSettings checks settings and copies them onto poll, leaving out
+// anything that doesn't apply to its vote type. The form and the API both
+// create and edit polls with it. The error explains which setting is wrong.
+func applyPollSettings(poll *database.Poll, settings api.PollSettings) error {
+	poll.ShortDescription = settings.ShortDescription
+	poll.LongDescription = settings.LongDescription
+	poll.Options = settings.Options
+	poll.AllowWriteIns = settings.AllowWriteIns
+	poll.VoteType = database.POLL_TYPE_SIMPLE
+	poll.TieBreak = ""
+	poll.Seats = 0
+	poll.MaxScore = 0
+	poll.Threshold = ""
+	poll.Motion = ""
+	poll.CountAbstain = false
+	poll.Quorum = 0
+	poll.QuorumPercent = 0
+	poll.OpensAt = nil
+	poll.ClosesAt = nil
+
+	switch settings.VoteType {
+	case "", database.POLL_TYPE_SIMPLE:
+	case database.POLL_TYPE_RANKED, database.POLL_TYPE_STV:
+		poll.VoteType = settings.VoteType
+		if poll.VoteType == database.POLL_TYPE_STV {
+			if settings.Seats < 1 {
+				return errors.New("An STV poll needs at least one seat")
+			}
+			poll.Seats = settings.Seats
+		}
+		switch settings.TieBreak {
+		case "", database.TIE_BREAK_PREVIOUS_ROUND:
+			poll.TieBreak = database.TIE_BREAK_PREVIOUS_ROUND
+		case database.TIE_BREAK_RANDOM, database.TIE_BREAK_CREATOR:
+			poll.TieBreak = settings.TieBreak
+		default:
+			return fmt.Errorf("Unknown tie break %q", settings.TieBreak)
+		}
+		// Recorded so a random tie break always draws the same way
+		poll.TieBreakSeed = rand.Int63()
+	case database.POLL_TYPE_CONDORCET, database.POLL_TYPE_APPROVAL:
+		poll.VoteType = settings.VoteType
+	case database.POLL_TYPE_SCORE, database.POLL_TYPE_STAR:
+		poll.VoteType = settings.VoteType
+		if settings.MaxScore < 1 {
+			return errors.New("The max score must be at least 1")
+		}
+		poll.MaxScore = settings.MaxScore
+		// Recorded so ties for a place in a STAR runoff always draw the same way
+		poll.TieBreakSeed = rand.Int63()
+	default:
+		return fmt.Errorf("Unknown vote type %q", settings.VoteType)
+	}
+	if poll.VoteType == database.POLL_TYPE_SIMPLE || poll.VoteType == database.POLL_TYPE_APPROVAL {
+		switch settings.Threshold {
+		case "":
+		case database.THRESHOLD_MAJORITY, database.THRESHOLD_TWO_THIRDS, database.THRESHOLD_THREE_QUARTERS, database.THRESHOLD_UNANIMOUS:
+			poll.Threshold = settings.Threshold
+			poll.CountAbstain = settings.CountAbstain
+		default:
+			return fmt.Errorf("Unknown threshold %q", settings.Threshold)
+		}
+		// The threshold is measured on one option, not whichever leads
+		if poll.Threshold != "" {
+			switch {
+			case settings.Motion == tally.Abstain:
+				return errors.New("The threshold can't be measured on Abstain")
+			case settings.Motion != "" && !containsString(poll.Options, settings.Motion):
+				return fmt.Errorf("The threshold is measured on %q, which isn't an option", settings.Motion)
+			case settings.Motion == "" && !containsString(poll.Options, tally.Pass):
+				return errors.New("Choose which option the threshold is measured on")
+			}
+			poll.Motion = settings.Motion
+		}
+	}
+	if settings.Quorum < 0 {
+		return errors.New("Quorum must be a number of voters")
+	}
+	poll.Quorum = settings.Quorum
+	if settings.QuorumPercent < 0 || settings.QuorumPercent > 100 {
+		return errors.New("Quorum must be a percentage of the voter roll")
+	}
+	poll.QuorumPercent = settings.QuorumPercent
+
+	poll.Eligibility = eligibility.Policy{Kind: eligibility.KindDefault}
+	switch settings.Eligibility.Kind {
+	case "", eligibility.KindDefault:
+	case eligibility.KindEveryone:
+		poll.Eligibility.Kind = eligibility.KindEveryone
+	case eligibility.KindGroups:
+		poll.Eligibility.Kind = eligibility.KindGroups
+		poll.Eligibility.Groups = settings.Eligibility.Groups
+		poll.Eligibility.ExcludedGroups = settings.Eligibility.ExcludedGroups
+		if len(poll.Eligibility.Groups) == 0 {
+			return errors.New("List at least one group that can vote")
+		}
+	case eligibility.KindUsers:
+		poll.Eligibility.Kind = eligibility.KindUsers
+		poll.Eligibility.Users = settings.Eligibility.Users
+		if len(poll.Eligibility.Users) == 0 {
+			return errors.New("List at least one user who can vote")
+		}
+	default:
+		return fmt.Errorf("Unknown eligibility %q", settings.Eligibility.Kind)
+	}
+
+	poll.OpensAt = settings.OpensAt
+	if settings.ClosesAt != nil {
+		if poll.OpensAt != nil && !settings.ClosesAt.After(*poll.OpensAt) {
+			return errors.New("A poll must close after it opens")
+		}
+		poll.ClosesAt = settings.ClosesAt
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated form field, dropping blank entries
+func splitList(field string) []string {
+	var items []string
+	for _, item := range strings.Split(field, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// applySchedule opens a poll that is going live, or schedules it if it
+// opens later. The error explains why it can't go live.
+func applySchedule(poll *database.Poll, now time.Time) error {
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(now) {
+		return errors.New("A poll must close after it opens")
+	}
+	if poll.OpensAt != nil && poll.OpensAt.After(now) {
+		poll.Open = false
+		poll.Scheduled = true
+	} else {
+		poll.OpensAt = nil
+		poll.Open = true
+		poll.Scheduled = false
+	}
+	return nil
+}
+
+// renderPollForm shows the create form, filled in with poll's settings when
+// it is being edited
+func renderPollForm(c *gin.Context, claims cshAuth.CSHClaims, poll *database.Poll) {
+	customOptions := ""
+	if poll.Id != "" {
+		customOptions = strings.Join(poll.Options, ", ")
+	}
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.In(time.Local).Format(scheduleLayout)
+	}
+
+	c.HTML(200, "create.tmpl", gin.H{
+		"Id":               poll.Id,
+		"Draft":            poll.Draft,
+		"ShortDescription": poll.ShortDescription,
+		"LongDescription":  poll.LongDescription,
+		"CustomOptions":    customOptions,
+		"AllowWriteIns":    poll.AllowWriteIns,
+		"VoteType":         poll.VoteType,
+		"TieBreak":         poll.TieBreak,
+		"Seats":            poll.Seats,
+		"MaxScore":         poll.MaxScore,
+		"Threshold":        poll.Threshold,
+		"Motion":           poll.Motion,
+		"CountAbstain":     poll.CountAbstain,
+		"Quorum":           poll.Quorum,
+		"QuorumPercent":    poll.QuorumPercent,
+		"Eligibility":      string(poll.Eligibility.Kind),
+		"EligibleGroups":   strings.Join(poll.Eligibility.Groups, ", "),
+		"ExcludedGroups":   strings.Join(poll.Eligibility.ExcludedGroups, ", "),
+		"EligibleUsers":    strings.Join(poll.Eligibility.Users, ", "),
+		"OpensAt":          formatTime(poll.OpensAt),
+		"ClosesAt":         formatTime(poll.ClosesAt),
+		"Username":         claims.UserInfo.Username,
+		"FullName":         claims.UserInfo.FullName,
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+	// Lets TZ choose the time zone polls are scheduled in, even in an image
+	// without zoneinfo
+	_ "time/tzdata"
+
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/logging"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// schedulerInterval is how often polls are checked for opening and closing,
+// so a poll may open or close up to this long after its scheduled time
+const schedulerInterval = 15 * time.Second
+
+// runScheduler opens and closes polls at their scheduled times until ctx is
+// cancelled
+func runScheduler(ctx context.Context, broker *sse.Broker) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		// A pass is finished even if ctx is cancelled during it, so no poll
+		// is left half opened
+		schedulePolls(context.WithoutCancel(ctx), broker, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedulePolls opens every scheduled poll whose OpensAt has passed and
+// closes every open poll whose ClosesAt has passed
+func schedulePolls(ctx context.Context, broker *sse.Broker, now time.Time) {
+	scheduled, err := database.GetScheduledPolls(ctx)
+	if err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "schedulePolls"}).Error("error getting scheduled polls")
+	}
+	for _, poll := range scheduled {
+		if poll.OpensAt == nil || poll.OpensAt.After(now) {
+			continue
+		}
+		roll, err := takeRoll(ctx, poll)
+		if err != nil {
+			// Try again next time rather than open without a roll
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "schedulePolls", "poll": poll.Id}).Error("error taking voter roll")
+			continue
+		}
+		err = poll.Start(ctx, roll)
+		if errors.Is(err, database.ErrPollNotScheduled) {
+			// Another instance opened it first
+			continue
+		}
+		if err != nil {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "schedulePolls", "poll": poll.Id}).Error("error opening poll")
+			continue
+		}
+		writeScheduledAction(ctx, poll, "Open Poll (scheduled)")
+		publishState(broker, poll.Id, true)
+	}
+
+	open, err := database.GetOpenPolls(ctx)
+	if err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "schedulePolls"}).Error("error getting open polls")
+	}
+	for _, poll := range open {
+		if poll.ClosesAt == nil || poll.ClosesAt.After(now) {
+			continue
+		}
+		err := poll.Close(ctx)
+		if errors.Is(err, database.ErrPollClosed) {
+			// Another instance closed it first
+			continue
+		}
+		if err != nil {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "schedulePolls", "poll": poll.Id}).Error("error closing poll")
+			continue
+		}
+		writeScheduledAction(ctx, poll, "Close/End Poll (scheduled)")
+		publishState(broker, poll.Id, false)
+	}
+}
+
+func writeScheduledAction(ctx context.Context, poll *database.Poll, action string) {
+	pId, _ := primitive.ObjectIDFromHex(poll.Id)
+	err := database.WriteAction(ctx, &database.Action{
+		Id:     "",
+		PollId: pId,
+		Date:   primitive.NewDateTimeFromTime(time.Now()),
+		User:   "scheduler",
+		Action: action,
+	})
+	if err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "scheduler", "method": "writeScheduledAction", "poll": poll.Id}).Error("error writing action")
+	}
+}
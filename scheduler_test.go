@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/directory"
+	"github.com/computersciencehouse/vote/eligibility"
+	"github.com/computersciencehouse/vote/sse"
+)
+
+// staleStore lists the polls another instance saw before this one opened
+// and closed them
+type staleStore struct {
+	*database.MemoryStore
+	scheduled, open []*database.Poll
+}
+
+func (s *staleStore) GetScheduledPolls(ctx context.Context) ([]*database.Poll, error) {
+	return s.scheduled, nil
+}
+
+func (s *staleStore) GetOpenPolls(ctx context.Context) ([]*database.Poll, error) {
+	return s.open, nil
+}
+
+func TestSchedulePolls(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	database.SetStore(store)
+	members = directory.NewFile("directory/testdata/members.json")
+	defer func() { members = nil }()
+	broker := sse.NewBroker()
+	go broker.Listen(t.Context())
+
+	now := time.Date(2026, time.March, 2, 19, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	opening, _ := store.CreatePoll(ctx, &database.Poll{
+		Scheduled:   true,
+		OpensAt:     &past,
+		ClosesAt:    &future,
+		Eligibility: eligibility.Policy{Kind: eligibility.KindEveryone},
+	})
+	waiting, _ := store.CreatePoll(ctx, &database.Poll{Scheduled: true, OpensAt: &future})
+	closing, _ := store.CreatePoll(ctx, &database.Poll{Open: true, ClosesAt: &past})
+	scheduled, _ := store.GetScheduledPolls(ctx)
+	open, _ := store.GetOpenPolls(ctx)
+
+	schedulePolls(ctx, broker, now)
+
+	poll, _ := store.GetPoll(ctx, opening)
+	if !poll.Open || poll.Scheduled || poll.Roll == nil || !reflect.DeepEqual(poll.Roll.Voters, []string{"alice", "bob", "carol"}) {
+		t.Errorf("poll due to open = %+v, roll %+v", poll, poll.Roll)
+	}
+	if poll, _ := store.GetPoll(ctx, waiting); poll.Open || !poll.Scheduled {
+		t.Errorf("poll not due to open = %+v", poll)
+	}
+	if poll, _ := store.GetPoll(ctx, closing); poll.Open {
+		t.Errorf("poll due to close = %+v", poll)
+	}
+
+	var written []string
+	for _, action := range store.Actions() {
+		written = append(written, action.PollId.Hex()+" "+action.Action+" by "+action.User)
+	}
+	want := []string{
+		opening + " Open Poll (scheduled) by scheduler",
+		closing + " Close/End Poll (scheduled) by scheduler",
+	}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("actions = %v, want %v", written, want)
+	}
+
+	// Another instance working from the same lists finds nothing to do
+	database.SetStore(&staleStore{MemoryStore: store, scheduled: scheduled, open: open})
+	defer database.SetStore(store)
+	schedulePolls(ctx, broker, now)
+
+	if len(store.Actions()) != len(want) {
+		t.Errorf("a second pass wrote %v", store.Actions()[len(want):])
+	}
+	if again, _ := store.GetPoll(ctx, opening); !reflect.DeepEqual(again.Roll, poll.Roll) {
+		t.Errorf("a second pass took the roll again: %+v", again.Roll)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/logging"
+	"github.com/computersciencehouse/vote/sse"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultShutdownTimeout is how long requests get to finish when the server
+// is stopped, unless VOTE_SHUTDOWN_TIMEOUT says otherwise
+const defaultShutdownTimeout = 15 * time.Second
+
+// serve runs the server until it is sent SIGINT or SIGTERM, then shuts it
+// down: it stops accepting requests, tells SSE clients to reconnect, waits
+// for requests in flight such as votes being cast, then stops the broker
+// and disconnects from the database.
+func serve(handler http.Handler, broker *sse.Broker) {
+	timeout := defaultShutdownTimeout
+	if value := os.Getenv("VOTE_SHUTDOWN_TIMEOUT"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "main", "method": "serve"}).Fatal("invalid VOTE_SHUTDOWN_TIMEOUT")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The broker outlives the server, so votes cast during shutdown still
+	// publish their results
+	listening, stopListening := context.WithCancel(context.Background())
+	defer stopListening()
+	go broker.Listen(listening)
+
+	scheduled := make(chan struct{})
+	go func() {
+		runScheduler(ctx, broker)
+		close(scheduled)
+	}()
+
+	server := &http.Server{Addr: address(), Handler: handler}
+	// Streams never end on their own, so shutdown would wait out its whole
+	// timeout on them
+	server.RegisterOnShutdown(broker.Close)
+	go func() {
+		logging.Logger.WithFields(logrus.Fields{"module": "main", "method": "serve", "address": server.Addr}).Info("listening")
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logging.Logger.WithFields(logrus.Fields{"error": err, "module": "main", "method": "serve"}).Fatal("error serving")
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logging.Logger.WithFields(logrus.Fields{"module": "main", "method": "serve", "timeout": timeout}).Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Logger.WithFields(logrus.Fields{"error": err, "module": "main", "method": "serve"}).Error("error waiting for requests to finish")
+	}
+	select {
+	case <-scheduled:
+	case <-shutdownCtx.Done():
+		logging.Logger.WithFields(logrus.Fields{"module": "main", "method": "serve"}).Error("gave up waiting for the scheduler")
+	}
+	stopListening()
+
+	database.Disconnect()
+	logging.Logger.WithFields(logrus.Fields{"module": "main", "method": "serve"}).Info("shut down")
+}
+
+// address is where to listen, on PORT like gin does by default
+func address() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
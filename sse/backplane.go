@@ -0,0 +1,56 @@
+package sse
+
+import (
+	"context"
+)
+
+// Backplane carries events between the brokers of every instance of the
+// server, so viewers connected to one instance see events published on any
+// of them
+type Backplane interface {
+	// Publish sends an event to every broker
+	Publish(ctx context.Context, event NotificationEvent) error
+	// Subscribe sends every event published by any broker to events, with
+	// its Id set, until ctx is done. Every broker must be sent the events in
+	// the same order, and the ids of a topic's events must increase in that
+	// order.
+	Subscribe(ctx context.Context, events chan<- NotificationEvent) error
+}
+
+// LocalBackplane is a Backplane for a single instance, which only carries
+// events within the process
+type LocalBackplane struct {
+	events chan NotificationEvent
+}
+
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{events: make(chan NotificationEvent, clientBuffer)}
+}
+
+func (backplane *LocalBackplane) Publish(ctx context.Context, event NotificationEvent) error {
+	select {
+	case backplane.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe numbers events from 1 on each topic. It must only be called once.
+func (backplane *LocalBackplane) Subscribe(ctx context.Context, events chan<- NotificationEvent) error {
+	lastIds := make(map[string]uint64)
+	for {
+		select {
+		case event := <-backplane.events:
+			lastIds[event.Topic]++
+			event.Id = lastIds[event.Topic]
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package sse
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// sharedBackplane stands in for a database shared by several instances. It
+// numbers events globally and delivers them to every subscriber.
+type sharedBackplane struct {
+	mutex       sync.Mutex
+	lastId      uint64
+	subscribers []chan<- NotificationEvent
+	subscribed  sync.WaitGroup
+}
+
+func (backplane *sharedBackplane) Publish(ctx context.Context, event NotificationEvent) error {
+	backplane.subscribed.Wait()
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+	backplane.lastId++
+	event.Id = backplane.lastId
+	for _, subscriber := range backplane.subscribers {
+		subscriber <- event
+	}
+	return nil
+}
+
+func (backplane *sharedBackplane) Subscribe(ctx context.Context, events chan<- NotificationEvent) error {
+	backplane.mutex.Lock()
+	backplane.subscribers = append(backplane.subscribers, events)
+	backplane.mutex.Unlock()
+	backplane.subscribed.Done()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSharedBackplane(t *testing.T) {
+	backplane := &sharedBackplane{}
+	backplane.subscribed.Add(2)
+	var brokers []*Broker
+	for i := 0; i < 2; i++ {
+		broker := NewBroker()
+		broker.Backplane = backplane
+		go broker.Listen(t.Context())
+		brokers = append(brokers, broker)
+	}
+
+	viewer := brokers[1].subscribe("poll", false, 0)
+	defer brokers[1].unsubscribe(viewer)
+	publisher := brokers[0].subscribe("poll", false, 0)
+	defer brokers[0].unsubscribe(publisher)
+
+	// A vote counted on one instance reaches viewers of the other
+	brokers[0].Notifier <- NotificationEvent{Topic: "poll", Payload: "results"}
+	for _, client := range []*client{viewer, publisher} {
+		if event := receive(t, client); event.Id != 1 || event.Payload != "results" {
+			t.Errorf("got %+v", event)
+		}
+	}
+}
+
+// numberedBackplane numbers events with ids, in order, like a database whose
+// ids are taken before events are inserted
+type numberedBackplane struct {
+	ids    []uint64
+	events chan NotificationEvent
+}
+
+func (backplane *numberedBackplane) Publish(ctx context.Context, event NotificationEvent) error {
+	event.Id, backplane.ids = backplane.ids[0], backplane.ids[1:]
+	backplane.events <- event
+	return nil
+}
+
+func (backplane *numberedBackplane) Subscribe(ctx context.Context, events chan<- NotificationEvent) error {
+	for {
+		select {
+		case event := <-backplane.events:
+			events <- event
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestReplayOutOfOrder(t *testing.T) {
+	broker := NewBroker()
+	broker.Backplane = &numberedBackplane{ids: []uint64{8, 7, 9}, events: make(chan NotificationEvent)}
+	go broker.Listen(t.Context())
+	publish(t, broker, "poll", "8", "7", "9")
+
+	// A client is sent what arrived after the last event it saw, whatever
+	// the ids
+	for lastId, want := range map[uint64][]uint64{7: {9}, 8: {7, 9}} {
+		client := broker.subscribe("poll", true, lastId)
+		for _, id := range want {
+			if event := receive(t, client); event.Id != id {
+				t.Errorf("resuming after %d, got %+v, want id %d", lastId, event, id)
+			}
+		}
+		if len(client.events) > 0 {
+			t.Errorf("resuming after %d, got %d more events", lastId, len(client.events))
+		}
+		broker.unsubscribe(client)
+	}
+}
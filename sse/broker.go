@@ -24,36 +24,108 @@ CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 package sse
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
-const patience time.Duration = time.Second * 1
+const (
+	// clientBuffer is how many events can wait for a client before the
+	// oldest are dropped
+	clientBuffer = 16
+	// replayBuffer is how many of a topic's latest events are kept for
+	// clients that reconnect
+	replayBuffer = 16
+)
 
 type (
 	NotificationEvent struct {
+		// Id is set by the backplane, and names the same event on every
+		// instance. It increases over the events of a topic.
+		Id uint64
+		// Topic is who the event is sent to, the clients following it
+		Topic string
+		// EventName is sent as the event's type, so clients following a
+		// topic can tell its kinds of events apart
 		EventName string
 		Payload   interface{}
 	}
 
 	NotifierChan chan NotificationEvent
 
+	// client is one connection following a topic
+	client struct {
+		topic  string
+		events NotifierChan
+		// resume is set when the client is reconnecting, and has seen every
+		// event up to lastId
+		resume bool
+		lastId uint64
+	}
+
+	// topic is the clients following a topic, and its latest events in the
+	// order they arrived
+	topic struct {
+		history []NotificationEvent
+		clients map[*client]struct{}
+		// idleSince is when the last client stopped following the topic
+		idleSince time.Time
+	}
+
 	Broker struct {
 
 		// Events are pushed to this channel by the main events-gathering routine
 		Notifier NotifierChan
 
+		// Backplane carries events to the brokers of every instance, and
+		// back to this one. It must be set before Listen is called.
+		Backplane Backplane
+
+		// Events from the backplane
+		incoming NotifierChan
+
+		// closing is closed by Close, to end every stream
+		closing   chan struct{}
+		closeOnce sync.Once
+
+		// stopped is closed when Listen returns
+		stopped chan struct{}
+
+		// Heartbeat is how often an idle connection is sent a comment, so
+		// proxies don't drop it
+		Heartbeat time.Duration
+
+		// Retry is how long browsers wait before reconnecting
+		Retry time.Duration
+
+		// TopicTimeout is how long a topic and its history are kept after
+		// its last client leaves, which must be long enough for clients to
+		// reconnect
+		TopicTimeout time.Duration
+
+		// Presence, if set, is called on its own goroutine with a topic
+		// whenever a client starts or stops following it
+		Presence func(topic string)
+
+		// presence counts the clients following each topic, for Clients
+		presence      map[string]int
+		presenceMutex sync.Mutex
+
 		// New client connections
-		newClients chan NotifierChan
+		newClients chan *client
 
 		// Closed client connections
-		closingClients chan NotifierChan
+		closingClients chan *client
 
-		// Client connections registry
-		clients map[NotifierChan]struct{}
+		// Client connections registry, by topic
+		topics map[string]*topic
 	}
 )
 
@@ -61,34 +133,71 @@ func NewBroker() (broker *Broker) {
 	// Instantiate a broker
 	return &Broker{
 		Notifier:       make(NotifierChan, 1),
-		newClients:     make(chan NotifierChan),
-		closingClients: make(chan NotifierChan),
-		clients:        make(map[NotifierChan]struct{}),
+		Backplane:      NewLocalBackplane(),
+		incoming:       make(NotifierChan, 1),
+		Heartbeat:      15 * time.Second,
+		Retry:          3 * time.Second,
+		TopicTimeout:   10 * time.Minute,
+		newClients:     make(chan *client),
+		closingClients: make(chan *client),
+		topics:         make(map[string]*topic),
+		presence:       make(map[string]int),
+		closing:        make(chan struct{}),
+		stopped:        make(chan struct{}),
 	}
 }
 
 func (broker *Broker) ServeHTTP(c *gin.Context) {
-	eventName := c.Param("topic")
+	broker.Serve(c, nil)
+}
 
-	// Each connection registers its own message channel with the Broker's connections registry
-	messageChan := make(NotifierChan)
+// Serve streams the topic named in the path like ServeHTTP, but only sends
+// the events allow accepts, if it is set
+func (broker *Broker) Serve(c *gin.Context, allow func(event NotificationEvent) bool) {
+	// A reconnecting browser sends the id of the last event it saw, and is
+	// sent what it missed
+	lastId, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
 
-	// Signal the broker that we have a new connection
-	broker.newClients <- messageChan
+	// Each connection registers its own message channel with the Broker's connections registry
+	client := broker.subscribe(c.Param("topic"), err == nil, lastId)
 
 	// Remove this client from the map of connected clients
 	// when this handler exits.
-	defer func() {
-		broker.closingClients <- messageChan
-	}()
+	defer broker.unsubscribe(client)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	fmt.Fprintf(c.Writer, "retry:%d\n\n", broker.Retry.Milliseconds())
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(broker.Heartbeat)
+	defer heartbeat.Stop()
 
 	c.Stream(func(w io.Writer) bool {
 		// Emit Server Sent Events compatible
-		event := <-messageChan
-
-		switch eventName {
-		case event.EventName:
-			c.SSEvent(event.EventName, event.Payload)
+		select {
+		case event := <-client.events:
+			if allow != nil && !allow(event) {
+				return true
+			}
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(event.Id, 10),
+				Event: event.EventName,
+				Data:  event.Payload,
+			})
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-c.Request.Context().Done():
+			// Quiet topics would otherwise never notice the client leaving
+			return false
+		case <-broker.closing:
+			// Browsers reconnect on their own once the stream ends, to
+			// another instance or to this one when it is back
+			c.Render(-1, sse.Event{Event: "reconnect", Data: "The server is restarting"})
+			c.Writer.Flush()
+			return false
 		}
 
 		// Flush the data immediately instead of buffering it for later.
@@ -98,33 +207,185 @@ func (broker *Broker) ServeHTTP(c *gin.Context) {
 	})
 }
 
-// Listen for new notifications and redistribute them to clients
-func (broker *Broker) Listen() {
+// subscribe registers a new client following name. A resuming client is
+// first sent the events after lastId.
+func (broker *Broker) subscribe(name string, resume bool, lastId uint64) *client {
+	client := &client{
+		topic:  name,
+		events: make(NotifierChan, clientBuffer),
+		resume: resume,
+		lastId: lastId,
+	}
+	select {
+	case broker.newClients <- client:
+	case <-broker.stopped:
+	}
+	return client
+}
+
+// unsubscribe stops sending events to a client
+func (broker *Broker) unsubscribe(client *client) {
+	select {
+	case broker.closingClients <- client:
+	case <-broker.stopped:
+	}
+}
+
+// Close ends every stream, telling its client to reconnect. Streams opened
+// afterwards end straight away. It doesn't stop Listen, so events published
+// while the server shuts down are still sent on.
+func (broker *Broker) Close() {
+	broker.closeOnce.Do(func() {
+		close(broker.closing)
+	})
+}
+
+// topic returns the state of a topic, starting it if needed. Topics are kept
+// for TopicTimeout after their last client leaves, so their history is there
+// for clients that reconnect.
+func (broker *Broker) topic(name string) *topic {
+	t, ok := broker.topics[name]
+	if !ok {
+		t = &topic{clients: make(map[*client]struct{}), idleSince: time.Now()}
+		broker.topics[name] = t
+	}
+	return t
+}
+
+// forget removes the topics that have had no clients for TopicTimeout
+func (broker *Broker) forget(now time.Time) {
+	for name, t := range broker.topics {
+		if len(t.clients) == 0 && now.Sub(t.idleSince) >= broker.TopicTimeout {
+			delete(broker.topics, name)
+		}
+	}
+}
+
+// Listen for new notifications and redistribute them to clients, until ctx
+// is done
+func (broker *Broker) Listen(ctx context.Context) {
+	defer close(broker.stopped)
+	go broker.publish(ctx)
+	go func() {
+		if err := broker.Backplane.Subscribe(ctx, broker.incoming); err != nil && ctx.Err() == nil {
+			log.Printf("Stopped receiving events: %v", err)
+		}
+	}()
+
+	sweep := time.NewTicker(broker.TopicTimeout)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case s := <-broker.newClients:
 
 			// A new client has connected.
-			// Register their message channel
-			broker.clients[s] = struct{}{}
-			log.Printf("Client added. %d registered clients", len(broker.clients))
+			// Register their message channel under their topic
+			t := broker.topic(s.topic)
+			t.clients[s] = struct{}{}
+			if s.resume {
+				for _, event := range t.since(s.lastId) {
+					s.send(event)
+				}
+			}
+			broker.setPresence(s.topic, len(t.clients))
+			log.Printf("Client added to %s. %d registered clients", s.topic, len(t.clients))
 		case s := <-broker.closingClients:
 
 			// A client has dettached and we want to
 			// stop sending them messages.
-			delete(broker.clients, s)
-			log.Printf("Removed client. %d registered clients", len(broker.clients))
-		case event := <-broker.Notifier:
+			t := broker.topic(s.topic)
+			delete(t.clients, s)
+			if len(t.clients) == 0 {
+				t.idleSince = time.Now()
+			}
+			broker.setPresence(s.topic, len(t.clients))
+			log.Printf("Removed client from %s. %d registered clients", s.topic, len(t.clients))
+		case event := <-broker.incoming:
 
 			// We got a new event from the outside!
-			// Send event to all connected clients
-			for clientMessageChan := range broker.clients {
-				select {
-				case clientMessageChan <- event:
-				case <-time.After(patience):
-					log.Print("Skipping client.")
-				}
+			// Keep it, and send it to the clients following its topic
+			t := broker.topic(event.Topic)
+			t.history = append(t.history, event)
+			if len(t.history) > replayBuffer {
+				t.history = t.history[len(t.history)-replayBuffer:]
+			}
+			for client := range t.clients {
+				client.send(event)
+			}
+		case now := <-sweep.C:
+			broker.forget(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Clients is how many clients are following topic on this instance
+func (broker *Broker) Clients(topic string) int {
+	broker.presenceMutex.Lock()
+	defer broker.presenceMutex.Unlock()
+	return broker.presence[topic]
+}
+
+// setPresence records how many clients are following topic, and calls
+// Presence
+func (broker *Broker) setPresence(topic string, clients int) {
+	broker.presenceMutex.Lock()
+	if clients == 0 {
+		delete(broker.presence, topic)
+	} else {
+		broker.presence[topic] = clients
+	}
+	broker.presenceMutex.Unlock()
+
+	if broker.Presence != nil {
+		go broker.Presence(topic)
+	}
+}
+
+// publish sends the events pushed to Notifier through the backplane
+func (broker *Broker) publish(ctx context.Context) {
+	for {
+		select {
+		case event := <-broker.Notifier:
+			publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := broker.Backplane.Publish(publishCtx, event); err != nil {
+				log.Printf("Error publishing an event to %s: %v", event.Topic, err)
 			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// since returns the kept events that arrived after the one with lastId. An
+// id that isn't kept is from too long ago or from before the server
+// restarted, so everything kept is new to it.
+func (t *topic) since(lastId uint64) []NotificationEvent {
+	for i, event := range t.history {
+		if event.Id == lastId {
+			return t.history[i+1:]
+		}
+	}
+	return t.history
+}
+
+// send queues an event for the client without waiting. A client too slow to
+// keep up loses its oldest events, since the newest ones are what it needs
+// to show.
+func (client *client) send(event NotificationEvent) {
+	for {
+		select {
+		case client.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-client.events:
+			log.Printf("Dropping an event for a slow client of %s", client.topic)
+		default:
 		}
 	}
 }
@@ -0,0 +1,324 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receive waits for the client's next event
+func receive(t *testing.T, client *client) NotificationEvent {
+	t.Helper()
+	select {
+	case event := <-client.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event for %s", client.topic)
+		return NotificationEvent{}
+	}
+}
+
+func TestBrokerTopics(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+
+	a := broker.subscribe("a", false, 0)
+	b := broker.subscribe("b", false, 0)
+	defer broker.unsubscribe(a)
+	defer broker.unsubscribe(b)
+
+	broker.Notifier <- NotificationEvent{Topic: "a", Payload: "1"}
+	broker.Notifier <- NotificationEvent{Topic: "b", Payload: "2"}
+
+	if event := receive(t, b); event.Payload != "2" {
+		t.Errorf("b got %+v", event)
+	}
+	if event := receive(t, a); event.Payload != "1" {
+		t.Errorf("a got %+v", event)
+	}
+	if len(a.events) != 0 || len(b.events) != 0 {
+		t.Errorf("clients got events for other topics")
+	}
+}
+
+func TestBrokerSlowClient(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+
+	slow := broker.subscribe("poll", false, 0)
+	fast := broker.subscribe("poll", false, 0)
+	defer broker.unsubscribe(slow)
+	defer broker.unsubscribe(fast)
+
+	// The slow client never reads, which must not hold up the fast one
+	events := clientBuffer * 3
+	for i := 0; i < events; i++ {
+		broker.Notifier <- NotificationEvent{Topic: "poll", Payload: i}
+		if event := receive(t, fast); event.Payload != i {
+			t.Fatalf("fast client got %+v, want %d", event, i)
+		}
+	}
+
+	if len(slow.events) != clientBuffer {
+		t.Fatalf("slow client has %d events waiting, want %d", len(slow.events), clientBuffer)
+	}
+	// The oldest events are the ones dropped
+	for i := events - clientBuffer; i < events; i++ {
+		if event := receive(t, slow); event.Payload != i {
+			t.Errorf("slow client got %+v, want %d", event, i)
+		}
+	}
+}
+
+// stream connects to topic on a test server for broker, sending lastEventId
+// if it isn't empty
+func stream(t *testing.T, broker *Broker, topic, lastEventId string) *bufio.Reader {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/stream/:topic", broker.ServeHTTP)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/stream/"+topic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	return bufio.NewReader(response.Body)
+}
+
+// readEvent reads lines up to the next blank one, keyed by field. Comments
+// are under "".
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+	event := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return event
+		}
+		field, value, _ := strings.Cut(line, ":")
+		event[field] = strings.TrimPrefix(value, " ")
+	}
+}
+
+// publish sends events on topic, and waits for the broker to number them
+func publish(t *testing.T, broker *Broker, topic string, payloads ...string) {
+	t.Helper()
+	sync := broker.subscribe(topic, false, 0)
+	defer broker.unsubscribe(sync)
+	for _, payload := range payloads {
+		broker.Notifier <- NotificationEvent{Topic: topic, EventName: "update", Payload: payload}
+		receive(t, sync)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	broker := NewBroker()
+	broker.Heartbeat = 50 * time.Millisecond
+	go broker.Listen(t.Context())
+
+	reader := stream(t, broker, "poll", "")
+	if event := readEvent(t, reader); event["retry"] != "3000" {
+		t.Errorf("first event = %v, want a retry hint", event)
+	}
+
+	publish(t, broker, "poll", "first", "second")
+	for i, want := range []string{"first", "second"} {
+		event := readEvent(t, reader)
+		if event["id"] != strconv.Itoa(i+1) || event["event"] != "update" || event["data"] != want {
+			t.Errorf("event %d = %v, want %q", i+1, event, want)
+		}
+	}
+
+	// Nothing else is sent, so the next thing is a heartbeat
+	if event := readEvent(t, reader); event[""] != "heartbeat" {
+		t.Errorf("idle stream sent %v, want a heartbeat", event)
+	}
+}
+
+func TestServeAllow(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/stream/:topic", func(c *gin.Context) {
+		broker.Serve(c, func(event NotificationEvent) bool {
+			return event.EventName != "secret"
+		})
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+	response, err := http.Get(server.URL + "/stream/poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	readEvent(t, reader) // the retry hint
+
+	// Only the events allowed through are sent, from the one topic
+	for _, name := range []string{"secret", "public"} {
+		broker.Notifier <- NotificationEvent{Topic: "poll", EventName: name, Payload: name}
+	}
+	if event := readEvent(t, reader); event["event"] != "public" || event["data"] != "public" {
+		t.Errorf("got %v, want only the public event", event)
+	}
+}
+
+func TestClose(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+
+	reader := stream(t, broker, "poll", "")
+	readEvent(t, reader) // the retry hint
+	broker.Close()
+	if event := readEvent(t, reader); event["event"] != "reconnect" {
+		t.Errorf("closing sent %v, want a reconnect event", event)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("the stream stayed open after closing: %v", err)
+	}
+
+	// Events published while shutting down are still sent on
+	client := broker.subscribe("poll", false, 0)
+	defer broker.unsubscribe(client)
+	broker.Notifier <- NotificationEvent{Topic: "poll", Payload: "late"}
+	if event := receive(t, client); event.Payload != "late" {
+		t.Errorf("after closing, got %+v", event)
+	}
+}
+
+func TestServeHTTPReplay(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+	publish(t, broker, "poll", "1", "2", "3")
+
+	tests := []struct {
+		name        string
+		lastEventId string
+		want        []string
+	}{
+		{"missed some", "1", []string{"2", "3"}},
+		{"missed none", "3", nil},
+		{"from before a restart", "40", []string{"1", "2", "3"}},
+		{"first connection", "", nil},
+	}
+	for _, test := range tests {
+		reader := stream(t, broker, "poll", test.lastEventId)
+		readEvent(t, reader) // the retry hint
+
+		var got []string
+		for range test.want {
+			got = append(got, readEvent(t, reader)["data"])
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: replayed %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Only the replayed events were sent, so the next is the newest
+	reader := stream(t, broker, "poll", "2")
+	readEvent(t, reader)
+	readEvent(t, reader)
+	publish(t, broker, "poll", "4")
+	if event := readEvent(t, reader); event["id"] != "4" || event["data"] != "4" {
+		t.Errorf("after replaying, got %v", event)
+	}
+}
+
+func TestReplayBuffer(t *testing.T) {
+	broker := NewBroker()
+	go broker.Listen(t.Context())
+	for i := 0; i < replayBuffer+5; i++ {
+		publish(t, broker, "poll", strconv.Itoa(i+1))
+	}
+
+	client := broker.subscribe("poll", true, 0)
+	defer broker.unsubscribe(client)
+	// Only the newest events are kept
+	for i := 6; i <= replayBuffer+5; i++ {
+		if event := receive(t, client); event.Id != uint64(i) {
+			t.Fatalf("replayed %+v, want id %d", event, i)
+		}
+	}
+}
+
+func TestTopicTimeout(t *testing.T) {
+	broker := NewBroker()
+	broker.TopicTimeout = 20 * time.Millisecond
+	go broker.Listen(t.Context())
+	publish(t, broker, "poll", "1")
+
+	// A topic nobody follows is forgotten along with its history
+	time.Sleep(100 * time.Millisecond)
+	client := broker.subscribe("poll", true, 0)
+	defer broker.unsubscribe(client)
+	publish(t, broker, "poll", "2")
+	if event := receive(t, client); event.Payload != "2" {
+		t.Errorf("after the topic timed out, got %+v", event)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	broker := NewBroker()
+	changed := make(chan string, 4)
+	broker.Presence = func(topic string) { changed <- topic }
+	go broker.Listen(t.Context())
+
+	// waitFor waits for Presence to be called for topic, then checks Clients
+	waitFor := func(topic string, want int) {
+		t.Helper()
+		select {
+		case got := <-changed:
+			if got != topic {
+				t.Errorf("Presence(%q), want %q", got, topic)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Presence was not called for %s", topic)
+		}
+		if got := broker.Clients(topic); got != want {
+			t.Errorf("Clients(%q) = %d, want %d", topic, got, want)
+		}
+	}
+
+	a := broker.subscribe("poll", false, 0)
+	waitFor("poll", 1)
+	b := broker.subscribe("poll", false, 0)
+	waitFor("poll", 2)
+	if got := broker.Clients("other"); got != 0 {
+		t.Errorf("Clients of a topic nobody follows = %d", got)
+	}
+
+	broker.unsubscribe(a)
+	waitFor("poll", 1)
+	broker.unsubscribe(b)
+	waitFor("poll", 0)
+}
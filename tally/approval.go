@@ -0,0 +1,50 @@
+package tally
+
+// ApprovalCount is the share of voters who approved of each candidate
+type ApprovalCount struct {
+	// Turnout is the number of ballots cast, including those approving of
+	// nothing
+	Turnout int `json:"turnout"`
+	// Percentages maps each candidate to the percentage of Turnout that
+	// approved of it
+	Percentages map[string]float64 `json:"percentages"`
+}
+
+// countApproval gives every candidate one vote for each ballot approving of
+// it. The candidates approved of by the most voters win.
+func countApproval(poll Poll, ballots []Ballot) *Result {
+	round := Round{Tallies: make(map[string]int)}
+	// Every option is shown, even without votes
+	for _, opt := range poll.Options {
+		round.Tallies[opt] = 0
+	}
+	for _, ballot := range ballots {
+		if len(ballot.Approved) == 0 {
+			round.Exhausted++
+			continue
+		}
+		// A choice approved of twice still only counts once
+		counted := make(map[string]bool)
+		for _, choice := range ballot.Approved {
+			if !counted[choice] {
+				counted[choice] = true
+				round.Tallies[choice]++
+			}
+		}
+	}
+
+	count := &ApprovalCount{Turnout: len(ballots), Percentages: make(map[string]float64)}
+	for candidate, votes := range round.Tallies {
+		count.Percentages[candidate] = 0
+		if count.Turnout > 0 {
+			count.Percentages[candidate] = float64(votes) * 100 / float64(count.Turnout)
+		}
+	}
+
+	return &Result{
+		Method:   Approval,
+		Rounds:   []Round{round},
+		Winners:  leaders(round.Tallies),
+		Approval: count,
+	}
+}
@@ -0,0 +1,35 @@
+package tally
+
+import "sort"
+
+// RankedBallot turns a stored ranking, which maps each choice to its rank
+// with 1 as most preferred, into a Ballot.
+//
+// Choices are ordered by rank and only their relative order matters, so gaps
+// are skipped: ranks 1, 2 and 5 are read as first, second and third. Ranks
+// below 1 leave a choice unranked. If two or more choices share a rank the
+// voter's preference between them is unknown, so the ballot stops just before
+// that rank and is treated as exhausted once its earlier choices are gone.
+func RankedBallot(ranks map[string]int) Ballot {
+	choices := make([]string, 0, len(ranks))
+	for choice, rank := range ranks {
+		if rank >= 1 {
+			choices = append(choices, choice)
+		}
+	}
+	sort.Slice(choices, func(i, j int) bool {
+		if ranks[choices[i]] != ranks[choices[j]] {
+			return ranks[choices[i]] < ranks[choices[j]]
+		}
+		return choices[i] < choices[j]
+	})
+
+	ranking := make([]string, 0, len(choices))
+	for i, choice := range choices {
+		if i+1 < len(choices) && ranks[choices[i+1]] == ranks[choice] {
+			break
+		}
+		ranking = append(ranking, choice)
+	}
+	return Ballot{Ranking: ranking}
+}
@@ -0,0 +1,166 @@
+package tally
+
+import "math/rand"
+
+// candidates returns the poll's options followed by any write-ins that appear
+// on the ballots
+func candidates(poll Poll, ballots []Ballot) []string {
+	seen := make(map[string]bool)
+	var all []string
+	for _, opt := range poll.Options {
+		if !seen[opt] {
+			seen[opt] = true
+			all = append(all, opt)
+		}
+	}
+	for _, ballot := range ballots {
+		for _, choice := range ballot.Ranking {
+			if !seen[choice] {
+				seen[choice] = true
+				all = append(all, choice)
+			}
+		}
+	}
+	return all
+}
+
+// topChoice returns the highest ranked continuing candidate on the ballot, or
+// "" if the ballot is exhausted
+func topChoice(ballot Ballot, continuing map[string]bool) string {
+	for _, choice := range ballot.Ranking {
+		if continuing[choice] {
+			return choice
+		}
+	}
+	return ""
+}
+
+// countInstantRunoff eliminates one candidate per round until a candidate
+// holds a majority of the ballots that are not exhausted, or every remaining
+// candidate is tied. Candidates with no votes are all eliminated in the same
+// round.
+func countInstantRunoff(poll Poll, ballots []Ballot) (*Result, error) {
+	result := &Result{Method: InstantRunoff}
+	breaker := &tieBreaker{poll: poll, rng: rand.New(rand.NewSource(poll.Seed))}
+	// history holds every earlier round's tallies for breaking ties
+	var history []map[string]float64
+
+	continuing := make(map[string]bool)
+	for _, candidate := range candidates(poll, ballots) {
+		continuing[candidate] = true
+	}
+
+	for len(continuing) > 0 {
+		round := Round{Tallies: make(map[string]int)}
+		for candidate := range continuing {
+			round.Tallies[candidate] = 0
+		}
+
+		active := 0
+		for _, ballot := range ballots {
+			if choice := topChoice(ballot, continuing); choice != "" {
+				round.Tallies[choice]++
+				active++
+			} else {
+				round.Exhausted++
+			}
+		}
+
+		if active == 0 {
+			result.Rounds = append(result.Rounds, round)
+			return result, nil
+		}
+
+		for candidate, count := range round.Tallies {
+			if count*2 > active {
+				round.Winner = candidate
+				result.Rounds = append(result.Rounds, round)
+				result.Winners = []string{candidate}
+				return result, nil
+			}
+		}
+
+		min := active
+		for _, count := range round.Tallies {
+			if count < min {
+				min = count
+			}
+		}
+		last := withCount(round.Tallies, min)
+
+		// Everyone left has the same number of votes, so nobody can be
+		// eliminated fairly
+		if len(last) == len(round.Tallies) {
+			round.Tied = last
+			result.Rounds = append(result.Rounds, round)
+			result.Winners = last
+			return result, nil
+		}
+
+		// Nobody has these candidates first, so no ballots move whichever
+		// order they go in, and there is no tie to break
+		if min == 0 && len(last) > 1 {
+			breaker.skip(last)
+			round.NoVotes = last
+			for _, candidate := range last {
+				delete(continuing, candidate)
+			}
+			result.Rounds = append(result.Rounds, round)
+			history = append(history, asVotes(round.Tallies))
+			continue
+		}
+
+		if len(last) == 1 {
+			round.Eliminated = last[0]
+		} else {
+			eliminated, record, err := breaker.choose(last, history)
+			if err != nil {
+				return nil, err
+			}
+			if record == nil {
+				result.Rounds = append(result.Rounds, round)
+				result.Pending = last
+				return result, nil
+			}
+			round.Eliminated = eliminated
+			round.TieBreak = record
+		}
+
+		var transferring []Ballot
+		for _, ballot := range ballots {
+			if topChoice(ballot, continuing) == round.Eliminated {
+				transferring = append(transferring, ballot)
+			}
+		}
+		delete(continuing, round.Eliminated)
+		round.Transfers = make(map[string]int)
+		for _, ballot := range transferring {
+			if next := topChoice(ballot, continuing); next != "" {
+				round.Transfers[next]++
+			} else {
+				round.ExhaustedTransfers++
+			}
+		}
+		result.Rounds = append(result.Rounds, round)
+		history = append(history, asVotes(round.Tallies))
+	}
+
+	return result, nil
+}
+
+func asVotes(tallies map[string]int) map[string]float64 {
+	votes := make(map[string]float64, len(tallies))
+	for candidate, count := range tallies {
+		votes[candidate] = float64(count)
+	}
+	return votes
+}
+
+func containsString(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
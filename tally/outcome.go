@@ -0,0 +1,146 @@
+package tally
+
+import "fmt"
+
+// Abstain is the option voters pick to take part in a poll without voting
+// for or against anything
+const Abstain = "Abstain"
+
+// Pass is the option a threshold is measured on when the poll doesn't name
+// another
+const Pass = "Pass"
+
+// Threshold is the share of the votes an option needs to pass
+type Threshold string
+
+const (
+	// ThresholdMajority needs more than half of the votes
+	ThresholdMajority Threshold = "majority"
+	// ThresholdTwoThirds needs at least two thirds of the votes
+	ThresholdTwoThirds Threshold = "two-thirds"
+	// ThresholdThreeQuarters needs at least three quarters of the votes
+	ThresholdThreeQuarters Threshold = "three-quarters"
+	// ThresholdUnanimous needs every vote
+	ThresholdUnanimous Threshold = "unanimous"
+)
+
+type Status string
+
+const (
+	StatusPassed   Status = "passed"
+	StatusFailed   Status = "failed"
+	StatusNoQuorum Status = "no-quorum"
+	// StatusUndecided is a poll with a threshold but no motion to measure it
+	// on
+	StatusUndecided Status = "undecided"
+)
+
+// Outcome is whether a poll passed, with the numbers used to decide it
+type Outcome struct {
+	Status    Status    `json:"status"`
+	Threshold Threshold `json:"threshold,omitempty"`
+	// CountAbstain is set when abstentions count towards the threshold
+	CountAbstain bool `json:"countAbstain"`
+	// Quorum is the number of ballots needed for the result to stand. When
+	// it is a share of the roll, QuorumPercent is that share and Roll is the
+	// size of the roll.
+	Quorum        int `json:"quorum,omitempty"`
+	QuorumPercent int `json:"quorumPercent,omitempty"`
+	Roll          int `json:"roll,omitempty"`
+	// Turnout is the number of ballots cast, including abstentions
+	Turnout int `json:"turnout"`
+	// Abstained is the number of votes for Abstain
+	Abstained int `json:"abstained"`
+	// Counted is the number of votes the threshold is measured against
+	Counted int `json:"counted"`
+	// Option is the motion the threshold is measured on, which Votes are
+	// for. It is empty when the poll has none.
+	Option string `json:"option,omitempty"`
+	Votes  int    `json:"votes"`
+	// Needed is the number of votes Option needed to pass
+	Needed int `json:"needed"`
+}
+
+// needed returns the fewest of counted votes that meet the threshold
+func (threshold Threshold) needed(counted int) (int, error) {
+	switch threshold {
+	case ThresholdMajority:
+		return counted/2 + 1, nil
+	case ThresholdTwoThirds:
+		return (counted*2 + 2) / 3, nil
+	case ThresholdThreeQuarters:
+		return (counted*3 + 3) / 4, nil
+	case ThresholdUnanimous:
+		return counted, nil
+	}
+	return 0, fmt.Errorf("unknown threshold %q", threshold)
+}
+
+// decide works out the outcome of a count. A poll without enough ballots
+// has no quorum, where enough is poll.Quorum or poll.QuorumPercent of the
+// roll, whichever is more. Otherwise, a plurality or approval count passes if its motion
+// has at least the threshold of the counted votes, which leave out
+// abstentions unless poll.CountAbstain is set. The motion is poll.Motion, or
+// Pass if it is one of the options, and the poll is undecided without one.
+// Other methods, and polls without a threshold, pass as long as they reach
+// quorum.
+func decide(poll Poll, turnout int, result *Result) (*Outcome, error) {
+	outcome := &Outcome{
+		Status:       StatusPassed,
+		Threshold:    poll.Threshold,
+		CountAbstain: poll.CountAbstain,
+		Quorum:       poll.Quorum,
+		Turnout:      turnout,
+		Counted:      turnout,
+	}
+	if poll.QuorumPercent > 0 && poll.Roll > 0 {
+		// Rounded up, so a quorum of half of 25 voters is 13
+		if needed := (poll.QuorumPercent*poll.Roll + 99) / 100; needed >= outcome.Quorum {
+			outcome.Quorum = needed
+			outcome.QuorumPercent = poll.QuorumPercent
+			outcome.Roll = poll.Roll
+		}
+	}
+	if turnout < outcome.Quorum {
+		outcome.Status = StatusNoQuorum
+	}
+	if poll.Threshold == "" || (result.Method != Plurality && result.Method != Approval) {
+		outcome.Threshold = ""
+		return outcome, nil
+	}
+
+	tallies := make(map[string]int)
+	for option, votes := range result.Rounds[0].Tallies {
+		if option == Abstain {
+			outcome.Abstained = votes
+		} else {
+			tallies[option] = votes
+		}
+	}
+	if !poll.CountAbstain {
+		outcome.Counted -= outcome.Abstained
+	}
+
+	motion := poll.Motion
+	if motion == "" && containsString(poll.Options, Pass) {
+		motion = Pass
+	}
+	if motion == "" || motion == Abstain {
+		if outcome.Status == StatusPassed {
+			outcome.Status = StatusUndecided
+		}
+		return outcome, nil
+	}
+	outcome.Option = motion
+	outcome.Votes = tallies[motion]
+
+	var err error
+	outcome.Needed, err = poll.Threshold.needed(outcome.Counted)
+	if err != nil {
+		return nil, err
+	}
+	if outcome.Status == StatusPassed && (outcome.Counted == 0 || outcome.Votes < outcome.Needed) {
+		outcome.Status = StatusFailed
+	}
+	return outcome, nil
+}
@@ -0,0 +1,131 @@
+package tally
+
+import "sort"
+
+// Condorcet is the pairwise comparison of every candidate, and the Schulze
+// ordering it produces
+type Condorcet struct {
+	// Candidates are listed in the order of Ranking
+	Candidates []string `json:"candidates"`
+	// Pairwise[a][b] is the number of voters who prefer a to b
+	Pairwise map[string]map[string]int `json:"pairwise"`
+	// Paths[a][b] is the strength of the strongest path from a to b, where a
+	// path is only as strong as its weakest pairwise win
+	Paths map[string]map[string]int `json:"paths"`
+	// Ranking groups tied candidates, most preferred first
+	Ranking [][]string `json:"ranking"`
+	// CondorcetWinner beats every other candidate head to head, if anyone does
+	CondorcetWinner string `json:"condorcetWinner,omitempty"`
+}
+
+// countSchulze ranks candidates with the Schulze method. A ballot prefers each
+// choice to every choice below it and to every candidate it leaves unranked;
+// unranked candidates aren't compared with each other.
+func countSchulze(poll Poll, ballots []Ballot) *Result {
+	all := candidates(poll, ballots)
+	condorcet := &Condorcet{
+		Pairwise: make(map[string]map[string]int),
+		Paths:    make(map[string]map[string]int),
+	}
+	for _, a := range all {
+		condorcet.Pairwise[a] = make(map[string]int)
+		condorcet.Paths[a] = make(map[string]int)
+		for _, b := range all {
+			if a != b {
+				condorcet.Pairwise[a][b] = 0
+			}
+		}
+	}
+
+	for _, ballot := range ballots {
+		ranked := make(map[string]bool)
+		for _, choice := range ballot.Ranking {
+			ranked[choice] = true
+			for _, other := range all {
+				if other != choice && !ranked[other] {
+					condorcet.Pairwise[choice][other]++
+				}
+			}
+		}
+	}
+
+	// The strongest paths start as the pairwise wins, then are widened through
+	// every other candidate in turn
+	for _, a := range all {
+		for _, b := range all {
+			if a == b {
+				continue
+			}
+			condorcet.Paths[a][b] = 0
+			if condorcet.Pairwise[a][b] > condorcet.Pairwise[b][a] {
+				condorcet.Paths[a][b] = condorcet.Pairwise[a][b]
+			}
+		}
+	}
+	for _, via := range all {
+		for _, a := range all {
+			if a == via {
+				continue
+			}
+			for _, b := range all {
+				if b == via || b == a {
+					continue
+				}
+				through := condorcet.Paths[a][via]
+				if condorcet.Paths[via][b] < through {
+					through = condorcet.Paths[via][b]
+				}
+				if through > condorcet.Paths[a][b] {
+					condorcet.Paths[a][b] = through
+				}
+			}
+		}
+	}
+
+	// The Schulze relation is transitive, so counting how many candidates
+	// each one beats orders them, and equal counts are ties
+	beats := make(map[string]int)
+	for _, a := range all {
+		pairwiseWins := 0
+		for _, b := range all {
+			if a == b {
+				continue
+			}
+			if condorcet.Paths[a][b] > condorcet.Paths[b][a] {
+				beats[a]++
+			}
+			if condorcet.Pairwise[a][b] > condorcet.Pairwise[b][a] {
+				pairwiseWins++
+			}
+		}
+		if len(all) > 1 && pairwiseWins == len(all)-1 {
+			condorcet.CondorcetWinner = a
+		}
+	}
+	condorcet.Candidates = append([]string(nil), all...)
+	sort.SliceStable(condorcet.Candidates, func(i, j int) bool {
+		return beats[condorcet.Candidates[i]] > beats[condorcet.Candidates[j]]
+	})
+	for i, candidate := range condorcet.Candidates {
+		if i > 0 && beats[candidate] == beats[condorcet.Candidates[i-1]] {
+			last := len(condorcet.Ranking) - 1
+			condorcet.Ranking[last] = append(condorcet.Ranking[last], candidate)
+		} else {
+			condorcet.Ranking = append(condorcet.Ranking, []string{candidate})
+		}
+	}
+
+	result := &Result{Method: Schulze, Condorcet: condorcet}
+	voted := false
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) > 0 {
+			voted = true
+			break
+		}
+	}
+	if voted && len(condorcet.Ranking) > 0 {
+		result.Winners = append([]string(nil), condorcet.Ranking[0]...)
+		sort.Strings(result.Winners)
+	}
+	return result
+}
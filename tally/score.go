@@ -0,0 +1,151 @@
+package tally
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// ScoreCount is how each candidate was rated by the voters
+type ScoreCount struct {
+	MaxScore int `json:"maxScore"`
+	// Turnout is the number of ballots cast
+	Turnout int `json:"turnout"`
+	// Totals maps each candidate to the sum of its scores
+	Totals map[string]int `json:"totals"`
+	// Averages maps each candidate to its mean score, counting every ballot
+	// that left it unscored as a 0
+	Averages map[string]float64 `json:"averages"`
+	// Runoff is the head to head between the two highest scoring candidates
+	// of a STAR count
+	Runoff *Runoff `json:"runoff,omitempty"`
+}
+
+// Runoff compares two finalists on every ballot
+type Runoff struct {
+	Finalists []string `json:"finalists"`
+	// Preferences maps each finalist to the number of ballots scoring them
+	// above the other finalist
+	Preferences map[string]int `json:"preferences"`
+	// NoPreference counts ballots scoring both finalists the same
+	NoPreference int `json:"noPreference"`
+	// TieBreak explains how the finalists were drawn when several
+	// candidates were tied for a place in the runoff
+	TieBreak *TieBreakRecord `json:"tieBreak,omitempty"`
+}
+
+// countScore totals the scores each ballot gives the candidates. The
+// candidates with the highest total win.
+func countScore(poll Poll, ballots []Ballot) *Result {
+	count := scoreCount(poll, ballots)
+	return &Result{
+		Method:  Score,
+		Rounds:  []Round{{Tallies: count.Totals}},
+		Winners: leaders(count.Totals),
+		Score:   count,
+	}
+}
+
+// countSTAR is score then automatic runoff. The two candidates with the
+// highest totals go to a runoff, which is won by the finalist more ballots
+// score above the other. If the runoff is tied the finalist with the higher
+// total wins. Ties for a place in the runoff are drawn at random with
+// Poll.Seed.
+func countSTAR(poll Poll, ballots []Ballot) *Result {
+	count := scoreCount(poll, ballots)
+	result := &Result{
+		Method: STAR,
+		Rounds: []Round{{Tallies: count.Totals}},
+		Score:  count,
+	}
+	if leaders(count.Totals) == nil {
+		return result
+	}
+
+	runoff := &Runoff{Preferences: make(map[string]int)}
+	runoff.Finalists, runoff.TieBreak = finalists(poll, count.Totals)
+	count.Runoff = runoff
+	if len(runoff.Finalists) == 1 {
+		result.Winners = runoff.Finalists
+		return result
+	}
+
+	a, b := runoff.Finalists[0], runoff.Finalists[1]
+	runoff.Preferences[a] = 0
+	runoff.Preferences[b] = 0
+	for _, ballot := range ballots {
+		switch {
+		case ballot.Scores[a] > ballot.Scores[b]:
+			runoff.Preferences[a]++
+		case ballot.Scores[b] > ballot.Scores[a]:
+			runoff.Preferences[b]++
+		default:
+			runoff.NoPreference++
+		}
+	}
+
+	result.Winners = leaders(runoff.Preferences)
+	if len(result.Winners) > 1 || result.Winners == nil {
+		result.Winners = leaders(map[string]int{a: count.Totals[a], b: count.Totals[b]})
+	}
+	return result
+}
+
+func scoreCount(poll Poll, ballots []Ballot) *ScoreCount {
+	count := &ScoreCount{
+		MaxScore: poll.MaxScore,
+		Turnout:  len(ballots),
+		Totals:   make(map[string]int),
+		Averages: make(map[string]float64),
+	}
+	for _, candidate := range candidates(poll, ballots) {
+		count.Totals[candidate] = 0
+	}
+	for _, ballot := range ballots {
+		for choice, score := range ballot.Scores {
+			count.Totals[choice] += score
+		}
+	}
+	for candidate, total := range count.Totals {
+		count.Averages[candidate] = 0
+		if count.Turnout > 0 {
+			count.Averages[candidate] = float64(total) / float64(count.Turnout)
+		}
+	}
+	return count
+}
+
+// finalists returns the two candidates with the highest totals, highest
+// first, or only one candidate if there is no one else. Candidates tied on
+// the boundary of the runoff are drawn at random, and the draw is recorded.
+func finalists(poll Poll, totals map[string]int) ([]string, *TieBreakRecord) {
+	ordered := make([]string, 0, len(totals))
+	for candidate := range totals {
+		ordered = append(ordered, candidate)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if totals[ordered[i]] != totals[ordered[j]] {
+			return totals[ordered[i]] > totals[ordered[j]]
+		}
+		return ordered[i] < ordered[j]
+	})
+	if len(ordered) <= 2 || totals[ordered[1]] != totals[ordered[2]] {
+		if len(ordered) > 2 {
+			ordered = ordered[:2]
+		}
+		return ordered, nil
+	}
+
+	// Everyone with the total of the last place in the runoff is tied for it
+	tied := withCount(totals, totals[ordered[1]])
+	var chosen []string
+	for _, candidate := range ordered {
+		if totals[candidate] > totals[ordered[1]] {
+			chosen = append(chosen, candidate)
+		}
+	}
+	rng := rand.New(rand.NewSource(poll.Seed))
+	for _, i := range rng.Perm(len(tied))[:2-len(chosen)] {
+		chosen = append(chosen, tied[i])
+	}
+	return chosen, &TieBreakRecord{Tied: tied, Rule: TieBreakRandom, Seed: poll.Seed}
+}
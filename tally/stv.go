@@ -0,0 +1,227 @@
+package tally
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// STVCount is a multi-winner single transferable vote count using the Droop
+// quota and Gregory surplus transfers
+type STVCount struct {
+	Seats int `json:"seats"`
+	// Quota is the number of votes that elects a candidate
+	Quota  float64    `json:"quota"`
+	Rounds []STVRound `json:"rounds"`
+}
+
+// STVRound is the state of an STV count after one pass over the ballots, and
+// the transfer made at the end of it
+type STVRound struct {
+	// Votes maps every candidate not yet eliminated to their votes, including
+	// candidates who were already elected
+	Votes map[string]float64 `json:"votes"`
+	// Exhausted is the value of ballots with no hopeful candidate left on them
+	Exhausted float64 `json:"exhausted"`
+	// Elected lists the candidates elected this round, most votes first
+	Elected []string `json:"elected,omitempty"`
+	// Surplus is the elected candidate whose votes above the quota are
+	// transferred at the end of the round
+	Surplus string `json:"surplus,omitempty"`
+	// TransferValue is the fraction of each of Surplus' ballots passed on
+	TransferValue float64 `json:"transferValue,omitempty"`
+	// Eliminated is the candidate removed at the end of the round when there
+	// was no surplus to transfer
+	Eliminated string          `json:"eliminated,omitempty"`
+	TieBreak   *TieBreakRecord `json:"tieBreak,omitempty"`
+	// Transfers maps each hopeful candidate to the value they receive from
+	// Surplus or Eliminated in the next round
+	Transfers map[string]float64 `json:"transfers,omitempty"`
+	// ExhaustedTransfers is the value that had no one left to transfer to
+	ExhaustedTransfers float64 `json:"exhaustedTransfers,omitempty"`
+}
+
+// paper is a ballot moving through an STV count
+type paper struct {
+	ranking []string
+	// value is what the ballot is worth after surplus transfers
+	value float64
+	// holder is the candidate the ballot currently counts for
+	holder string
+}
+
+// truncate rounds a transferred value down to four decimal places, so
+// fractions of a vote never round up into votes nobody cast
+func truncate(value float64) float64 {
+	return math.Floor(value*10000) / 10000
+}
+
+// countSTV elects poll.Seats candidates. A candidate reaching the Droop quota
+// is elected, and the part of their vote above the quota is passed on: every
+// one of their ballots moves to its next hopeful choice at the value
+// (votes - quota) / votes. When there is no surplus the candidate with the
+// fewest votes is eliminated and their ballots move on at full value. Once
+// the hopeful candidates can only just fill the remaining seats they are all
+// elected.
+func countSTV(poll Poll, ballots []Ballot) (*Result, error) {
+	seats := poll.Seats
+	if seats < 1 {
+		seats = 1
+	}
+	count := &STVCount{Seats: seats}
+	result := &Result{Method: STV, STV: count}
+	breaker := &tieBreaker{poll: poll, rng: rand.New(rand.NewSource(poll.Seed))}
+	var history []map[string]float64
+
+	hopeful := make(map[string]bool)
+	for _, candidate := range candidates(poll, ballots) {
+		hopeful[candidate] = true
+	}
+	nextChoice := func(p *paper) string {
+		for _, choice := range p.ranking {
+			if hopeful[choice] {
+				return choice
+			}
+		}
+		return ""
+	}
+
+	var papers []*paper
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) > 0 {
+			p := &paper{ranking: ballot.Ranking, value: 1}
+			p.holder = nextChoice(p)
+			papers = append(papers, p)
+		}
+	}
+	count.Quota = float64(len(papers)/(seats+1) + 1)
+
+	var elected []string
+	// settled holds the votes kept by elected candidates whose surplus has
+	// been transferred away
+	settled := make(map[string]float64)
+	// surpluses are elected candidates whose surplus hasn't been transferred
+	var surpluses []string
+	exhausted := 0.0
+
+	// transfer moves every ballot held by from to its next hopeful choice,
+	// multiplying its value by factor
+	transfer := func(round *STVRound, from string, factor float64) {
+		round.Transfers = make(map[string]float64)
+		for _, p := range papers {
+			if p.holder != from {
+				continue
+			}
+			p.value = truncate(p.value * factor)
+			p.holder = nextChoice(p)
+			if p.holder == "" {
+				exhausted += p.value
+				round.ExhaustedTransfers += p.value
+			} else {
+				round.Transfers[p.holder] += p.value
+			}
+		}
+	}
+
+	for {
+		round := STVRound{Votes: make(map[string]float64), Exhausted: exhausted}
+		for candidate := range hopeful {
+			round.Votes[candidate] = 0
+		}
+		for _, candidate := range elected {
+			round.Votes[candidate] = settled[candidate]
+		}
+		for _, p := range papers {
+			if p.holder != "" {
+				round.Votes[p.holder] += p.value
+			}
+		}
+
+		if len(papers) == 0 {
+			count.Rounds = append(count.Rounds, round)
+			return result, nil
+		}
+
+		round.Elected = byVotes(hopeful, round.Votes, func(votes float64) bool { return votes >= count.Quota })
+		for _, candidate := range round.Elected {
+			delete(hopeful, candidate)
+			elected = append(elected, candidate)
+			surpluses = append(surpluses, candidate)
+		}
+
+		if len(elected) < seats && len(hopeful)+len(elected) <= seats {
+			rest := byVotes(hopeful, round.Votes, func(float64) bool { return true })
+			for _, candidate := range rest {
+				delete(hopeful, candidate)
+			}
+			round.Elected = append(round.Elected, rest...)
+			elected = append(elected, rest...)
+		}
+		if len(elected) >= seats || len(hopeful) == 0 {
+			count.Rounds = append(count.Rounds, round)
+			break
+		}
+
+		// Surpluses go first, oldest first, one per round
+		for len(surpluses) > 0 && round.Surplus == "" {
+			from := surpluses[0]
+			surpluses = surpluses[1:]
+			if total := round.Votes[from]; total > count.Quota {
+				round.Surplus = from
+				round.TransferValue = (total - count.Quota) / total
+				settled[from] = count.Quota
+				transfer(&round, from, round.TransferValue)
+			}
+		}
+
+		if round.Surplus == "" {
+			hopefulVotes := make(map[string]float64)
+			for candidate := range hopeful {
+				hopefulVotes[candidate] = round.Votes[candidate]
+			}
+			last := fewest(hopefulVotes)
+			if len(last) == 1 {
+				round.Eliminated = last[0]
+			} else {
+				eliminated, record, err := breaker.choose(last, history)
+				if err != nil {
+					return nil, err
+				}
+				if record == nil {
+					count.Rounds = append(count.Rounds, round)
+					result.Winners = elected
+					result.Pending = last
+					return result, nil
+				}
+				round.Eliminated = eliminated
+				round.TieBreak = record
+			}
+			delete(hopeful, round.Eliminated)
+			transfer(&round, round.Eliminated, 1)
+		}
+
+		count.Rounds = append(count.Rounds, round)
+		history = append(history, round.Votes)
+	}
+
+	result.Winners = elected
+	return result, nil
+}
+
+// byVotes returns the candidates whose votes pass keep, most votes first and
+// then by name
+func byVotes(candidates map[string]bool, votes map[string]float64, keep func(votes float64) bool) []string {
+	var kept []string
+	for candidate := range candidates {
+		if keep(votes[candidate]) {
+			kept = append(kept, candidate)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if votes[kept[i]] != votes[kept[j]] {
+			return votes[kept[i]] > votes[kept[j]]
+		}
+		return kept[i] < kept[j]
+	})
+	return kept
+}
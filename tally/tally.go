@@ -0,0 +1,247 @@
+// Package tally counts ballots for a poll. It has no knowledge of how polls
+// or ballots are stored, so every counting method can be tested on its own.
+package tally
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Method string
+
+const (
+	// Plurality counts each ballot's first choice
+	Plurality Method = "plurality"
+	// InstantRunoff repeatedly eliminates the weakest candidate until one
+	// holds a majority of the continuing ballots
+	InstantRunoff Method = "instant-runoff"
+	// Schulze compares every pair of candidates and orders them by the
+	// strength of their strongest chains of pairwise wins
+	Schulze Method = "schulze"
+	// STV elects several candidates with the single transferable vote
+	STV Method = "stv"
+	// Approval counts every candidate each ballot approves of
+	Approval Method = "approval"
+	// Score totals the scores each ballot gives every candidate
+	Score Method = "score"
+	// STAR is score then automatic runoff between the two highest scoring
+	// candidates
+	STAR Method = "star"
+)
+
+// TieBreak decides which candidate is eliminated when several are tied for
+// last place
+type TieBreak string
+
+const (
+	// TieBreakPreviousRound eliminates whichever tied candidate had the fewest
+	// votes in the most recent round where they differed, falling back to
+	// TieBreakRandom if they were tied in every round
+	TieBreakPreviousRound TieBreak = "previous-round"
+	// TieBreakRandom draws the candidate to eliminate using Poll.Seed, so the
+	// same ballots and seed always give the same result
+	TieBreakRandom TieBreak = "random"
+	// TieBreakCreator eliminates the candidates listed in Poll.Decisions. The
+	// count stops and waits when a tie comes up that has not been decided.
+	TieBreakCreator TieBreak = "creator"
+)
+
+// Poll is the definition of what is being counted
+type Poll struct {
+	Method   Method
+	Options  []string
+	TieBreak TieBreak
+	// Seed drives random tie breaks
+	Seed int64
+	// Decisions are the candidates the creator chose to eliminate, in the
+	// order their ties came up
+	Decisions []string
+	// Seats is the number of candidates an STV count elects
+	Seats int
+	// MaxScore is the highest score a score or STAR ballot can give
+	MaxScore int
+	// Threshold is the share of the votes Motion needs for a plurality or
+	// approval count to pass
+	Threshold Threshold
+	// Motion is the option the threshold is measured on, Pass if it is empty
+	Motion string
+	// CountAbstain counts votes for Abstain towards the threshold, so
+	// abstaining has the same effect as voting against
+	CountAbstain bool
+	// Quorum is the number of ballots that must be cast for the result to
+	// stand
+	Quorum int
+	// QuorumPercent is the share of Roll, as a percentage, that must cast
+	// ballots for the result to stand. When both are set the larger quorum
+	// applies, and it is ignored for a poll without a roll.
+	QuorumPercent int
+	// Roll is the number of voters who could vote, 0 if the poll has no roll
+	Roll int
+}
+
+// Ballot is a single voter's choices, most preferred first. A plurality
+// ballot has exactly one choice. Choices that aren't in Poll.Options are
+// write-ins.
+type Ballot struct {
+	Ranking []string `json:"ranking"`
+	// Approved holds every choice an approval ballot approves of, in no
+	// particular order
+	Approved []string `json:"approved,omitempty"`
+	// Scores maps each choice a score or STAR ballot rated to its score.
+	// Choices left out are scored 0.
+	Scores map[string]int `json:"scores,omitempty"`
+}
+
+// Round is the state of the count after one pass over the ballots
+type Round struct {
+	// Tallies maps each candidate still in the count to its votes
+	Tallies map[string]int `json:"tallies"`
+	// Exhausted counts ballots with no continuing candidate left on them
+	Exhausted int `json:"exhausted"`
+	// Eliminated is the candidate removed at the end of the round
+	Eliminated string `json:"eliminated,omitempty"`
+	// NoVotes lists the candidates removed together at the end of the round
+	// instead of Eliminated, when several had no votes at all
+	NoVotes []string `json:"noVotes,omitempty"`
+	// TieBreak explains how Eliminated was chosen if it was tied for last
+	TieBreak *TieBreakRecord `json:"tieBreak,omitempty"`
+	// Transfers maps each continuing candidate to the number of Eliminated's
+	// ballots they receive in the next round
+	Transfers map[string]int `json:"transfers,omitempty"`
+	// ExhaustedTransfers counts Eliminated's ballots that have no one left
+	// to transfer to
+	ExhaustedTransfers int `json:"exhaustedTransfers,omitempty"`
+	// Winner is set on the round where a candidate reached a majority
+	Winner string `json:"winner,omitempty"`
+	// Tied is set on the round where every continuing candidate had the same
+	// number of votes, which ends the count in a tie
+	Tied []string `json:"tied,omitempty"`
+}
+
+// TieBreakRecord explains how a tie for last place was broken
+type TieBreakRecord struct {
+	Tied []string `json:"tied"`
+	// Rule is the rule that made the decision, which is TieBreakRandom when
+	// TieBreakPreviousRound could not separate the candidates
+	Rule TieBreak `json:"rule"`
+	// Round is the earlier round that separated the candidates under
+	// TieBreakPreviousRound, counting from 1
+	Round int `json:"round,omitempty"`
+	// Seed is the seed used by TieBreakRandom
+	Seed int64 `json:"seed,omitempty"`
+}
+
+type Result struct {
+	Method Method  `json:"method"`
+	Rounds []Round `json:"rounds"`
+	// Winners holds the winning candidate, or every tied candidate when the
+	// count ends in a tie. It is empty if no votes were cast.
+	Winners []string `json:"winners,omitempty"`
+	// Pending lists the candidates tied for last place when the count is
+	// waiting on the creator to choose one to eliminate
+	Pending []string `json:"pending,omitempty"`
+	// Condorcet holds the pairwise comparisons of a Schulze count
+	Condorcet *Condorcet `json:"condorcet,omitempty"`
+	// STV holds the rounds of an STV count, whose Winners are the elected
+	// candidates in the order they were elected
+	STV *STVCount `json:"stv,omitempty"`
+	// Approval holds the turnout and approval percentages of an approval
+	// count, whose approval counts are the tallies of its only round
+	Approval *ApprovalCount `json:"approval,omitempty"`
+	// Score holds the totals and averages of a score or STAR count, and the
+	// runoff of a STAR count
+	Score *ScoreCount `json:"score,omitempty"`
+	// Outcome is whether the poll passed, when it has a threshold or quorum
+	Outcome *Outcome `json:"outcome,omitempty"`
+}
+
+// Tie reports whether the count ended with more winners than seats
+func (result *Result) Tie() bool {
+	if result.STV != nil {
+		return false
+	}
+	return len(result.Winners) > 1
+}
+
+// Count tallies ballots using the poll's method
+func Count(poll Poll, ballots []Ballot) (*Result, error) {
+	var result *Result
+	var err error
+	switch poll.Method {
+	case Plurality:
+		result = countPlurality(poll, ballots)
+	case InstantRunoff:
+		result, err = countInstantRunoff(poll, ballots)
+	case Schulze:
+		result = countSchulze(poll, ballots)
+	case STV:
+		result, err = countSTV(poll, ballots)
+	case Approval:
+		result = countApproval(poll, ballots)
+	case Score:
+		result = countScore(poll, ballots)
+	case STAR:
+		result = countSTAR(poll, ballots)
+	default:
+		return nil, fmt.Errorf("unknown tally method %q", poll.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.Threshold != "" || poll.Quorum > 0 || poll.QuorumPercent > 0 {
+		result.Outcome, err = decide(poll, len(ballots), result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func countPlurality(poll Poll, ballots []Ballot) *Result {
+	round := Round{Tallies: make(map[string]int)}
+	// Every option is shown, even without votes
+	for _, opt := range poll.Options {
+		round.Tallies[opt] = 0
+	}
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) == 0 {
+			round.Exhausted++
+			continue
+		}
+		round.Tallies[ballot.Ranking[0]]++
+	}
+
+	return &Result{
+		Method:  Plurality,
+		Rounds:  []Round{round},
+		Winners: leaders(round.Tallies),
+	}
+}
+
+// leaders returns the candidates with the most votes, sorted by name. It
+// returns nothing when no candidate has a vote.
+func leaders(tallies map[string]int) []string {
+	max := 0
+	for _, count := range tallies {
+		if count > max {
+			max = count
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+	return withCount(tallies, max)
+}
+
+// withCount returns the candidates with exactly count votes, sorted by name
+func withCount(tallies map[string]int, count int) []string {
+	var candidates []string
+	for candidate, c := range tallies {
+		if c == count {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
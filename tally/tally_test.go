@@ -0,0 +1,905 @@
+package tally
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ranked builds ballots from rankings, most preferred first
+func ranked(rankings ...[]string) []Ballot {
+	ballots := make([]Ballot, 0, len(rankings))
+	for _, ranking := range rankings {
+		ballots = append(ballots, Ballot{Ranking: ranking})
+	}
+	return ballots
+}
+
+// repeat returns n copies of ranking
+func repeat(n int, ranking ...string) [][]string {
+	rankings := make([][]string, n)
+	for i := range rankings {
+		rankings[i] = ranking
+	}
+	return rankings
+}
+
+func concat(groups ...[][]string) [][]string {
+	var all [][]string
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+	return all
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		poll    Poll
+		ballots []Ballot
+		want    *Result
+	}{
+		{
+			name: "plurality with no votes",
+			poll: Poll{Method: Plurality, Options: []string{"Pass", "Fail", "Abstain"}},
+			want: &Result{
+				Method: Plurality,
+				Rounds: []Round{{Tallies: map[string]int{"Pass": 0, "Fail": 0, "Abstain": 0}}},
+			},
+		},
+		{
+			name:    "plurality winner",
+			poll:    Poll{Method: Plurality, Options: []string{"Pass", "Fail", "Abstain"}},
+			ballots: ranked(concat(repeat(3, "Pass"), repeat(1, "Fail"))...),
+			want: &Result{
+				Method:  Plurality,
+				Rounds:  []Round{{Tallies: map[string]int{"Pass": 3, "Fail": 1, "Abstain": 0}}},
+				Winners: []string{"Pass"},
+			},
+		},
+		{
+			name:    "plurality tie",
+			poll:    Poll{Method: Plurality, Options: []string{"Pass", "Fail"}},
+			ballots: ranked(concat(repeat(2, "Pass"), repeat(2, "Fail"))...),
+			want: &Result{
+				Method:  Plurality,
+				Rounds:  []Round{{Tallies: map[string]int{"Pass": 2, "Fail": 2}}},
+				Winners: []string{"Fail", "Pass"},
+			},
+		},
+		{
+			name:    "plurality write-in",
+			poll:    Poll{Method: Plurality, Options: []string{"Alice", "Bob"}},
+			ballots: ranked(concat(repeat(1, "Alice"), repeat(2, "Carol"))...),
+			want: &Result{
+				Method:  Plurality,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 1, "Bob": 0, "Carol": 2}}},
+				Winners: []string{"Carol"},
+			},
+		},
+		{
+			name: "instant runoff with no options or votes",
+			poll: Poll{Method: InstantRunoff},
+			want: &Result{Method: InstantRunoff},
+		},
+		{
+			name: "instant runoff with no votes",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob"}},
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{{Tallies: map[string]int{"Alice": 0, "Bob": 0}}},
+			},
+		},
+		{
+			name:    "instant runoff first round majority",
+			poll:    Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}},
+			ballots: ranked(concat(repeat(3, "Alice", "Bob"), repeat(1, "Bob"), repeat(1, "Carol"))...),
+			want: &Result{
+				Method:  InstantRunoff,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 3, "Bob": 1, "Carol": 1}, Winner: "Alice"}},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name: "instant runoff transfers",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}},
+			ballots: ranked(concat(
+				repeat(4, "Alice"),
+				repeat(3, "Bob", "Alice"),
+				repeat(3, "Carol", "Bob"),
+				repeat(2, "Carol", "Bob"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 4, "Bob": 3, "Carol": 5}, Eliminated: "Bob", Transfers: map[string]int{"Alice": 3}},
+					{Tallies: map[string]int{"Alice": 7, "Carol": 5}, Winner: "Alice"},
+				},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name: "instant runoff exhausted ballots",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}},
+			ballots: ranked(concat(
+				repeat(4, "Alice"),
+				repeat(3, "Bob"),
+				repeat(2, "Carol", "Bob"),
+				[][]string{{}},
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 4, "Bob": 3, "Carol": 2}, Exhausted: 1, Eliminated: "Carol", Transfers: map[string]int{"Bob": 2}},
+					{Tallies: map[string]int{"Alice": 4, "Bob": 5}, Exhausted: 1, Winner: "Bob"},
+				},
+				Winners: []string{"Bob"},
+			},
+		},
+		{
+			name: "instant runoff breaks ties on the previous round",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol", "Dave"}},
+			ballots: ranked(concat(
+				repeat(5, "Alice"),
+				repeat(3, "Bob"),
+				repeat(2, "Carol"),
+				repeat(1, "Dave", "Carol"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 5, "Bob": 3, "Carol": 2, "Dave": 1}, Eliminated: "Dave", Transfers: map[string]int{"Carol": 1}},
+					{
+						Tallies:            map[string]int{"Alice": 5, "Bob": 3, "Carol": 3},
+						Eliminated:         "Carol",
+						TieBreak:           &TieBreakRecord{Tied: []string{"Bob", "Carol"}, Rule: TieBreakPreviousRound, Round: 1},
+						Transfers:          map[string]int{},
+						ExhaustedTransfers: 3,
+					},
+					{Tallies: map[string]int{"Alice": 5, "Bob": 3}, Exhausted: 3, Winner: "Alice"},
+				},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name: "instant runoff waits for the creator to break a tie",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}, TieBreak: TieBreakCreator},
+			ballots: ranked(concat(
+				repeat(2, "Alice"),
+				repeat(1, "Bob", "Alice"),
+				repeat(1, "Carol"),
+			)...),
+			want: &Result{
+				Method:  InstantRunoff,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 2, "Bob": 1, "Carol": 1}}},
+				Pending: []string{"Bob", "Carol"},
+			},
+		},
+		{
+			name: "instant runoff uses the creator's decision",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}, TieBreak: TieBreakCreator, Decisions: []string{"Bob"}},
+			ballots: ranked(concat(
+				repeat(2, "Alice"),
+				repeat(1, "Bob", "Alice"),
+				repeat(1, "Carol"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{
+						Tallies:    map[string]int{"Alice": 2, "Bob": 1, "Carol": 1},
+						Eliminated: "Bob",
+						TieBreak:   &TieBreakRecord{Tied: []string{"Bob", "Carol"}, Rule: TieBreakCreator},
+						Transfers:  map[string]int{"Alice": 1},
+					},
+					{Tallies: map[string]int{"Alice": 3, "Carol": 1}, Winner: "Alice"},
+				},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name: "instant runoff eliminates everyone with no votes without a tie break",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol", "Dave", "Eve"}, TieBreak: TieBreakCreator},
+			ballots: ranked(concat(
+				repeat(2, "Alice"),
+				repeat(2, "Bob"),
+				repeat(1, "Carol", "Alice"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 2, "Bob": 2, "Carol": 1, "Dave": 0, "Eve": 0}, NoVotes: []string{"Dave", "Eve"}},
+					{Tallies: map[string]int{"Alice": 2, "Bob": 2, "Carol": 1}, Eliminated: "Carol", Transfers: map[string]int{"Alice": 1}},
+					{Tallies: map[string]int{"Alice": 3, "Bob": 2}, Winner: "Alice"},
+				},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name: "instant runoff skips decisions about candidates with no votes",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol", "Dave", "Eve"}, TieBreak: TieBreakCreator, Decisions: []string{"Dave", "Bob"}},
+			ballots: ranked(concat(
+				repeat(2, "Alice"),
+				repeat(1, "Bob", "Alice"),
+				repeat(1, "Carol"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 2, "Bob": 1, "Carol": 1, "Dave": 0, "Eve": 0}, NoVotes: []string{"Dave", "Eve"}},
+					{
+						Tallies:    map[string]int{"Alice": 2, "Bob": 1, "Carol": 1},
+						Eliminated: "Bob",
+						TieBreak:   &TieBreakRecord{Tied: []string{"Bob", "Carol"}, Rule: TieBreakCreator},
+						Transfers:  map[string]int{"Alice": 1},
+					},
+					{Tallies: map[string]int{"Alice": 3, "Carol": 1}, Winner: "Alice"},
+				},
+				Winners: []string{"Alice"},
+			},
+		},
+		{
+			name:    "instant runoff tie",
+			poll:    Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}},
+			ballots: ranked(concat(repeat(2, "Alice"), repeat(2, "Bob"), repeat(1, "Carol"))...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 2, "Bob": 2, "Carol": 1}, Eliminated: "Carol", Transfers: map[string]int{}, ExhaustedTransfers: 1},
+					{Tallies: map[string]int{"Alice": 2, "Bob": 2}, Exhausted: 1, Tied: []string{"Alice", "Bob"}},
+				},
+				Winners: []string{"Alice", "Bob"},
+			},
+		},
+		{
+			name: "instant runoff write-in",
+			poll: Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob"}},
+			ballots: ranked(concat(
+				repeat(2, "Alice"),
+				repeat(1, "Bob", "Zed"),
+				repeat(3, "Zed"),
+			)...),
+			want: &Result{
+				Method: InstantRunoff,
+				Rounds: []Round{
+					{Tallies: map[string]int{"Alice": 2, "Bob": 1, "Zed": 3}, Eliminated: "Bob", Transfers: map[string]int{"Zed": 1}},
+					{Tallies: map[string]int{"Alice": 2, "Zed": 4}, Winner: "Zed"},
+				},
+				Winners: []string{"Zed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Count() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountRandomTieBreak(t *testing.T) {
+	poll := Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol", "Dave"}, TieBreak: TieBreakRandom, Seed: 42}
+	ballots := ranked(concat(repeat(2, "Alice"), repeat(2, "Bob"), repeat(1, "Carol"), repeat(1, "Dave"))...)
+
+	first, err := Count(poll, ballots)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	record := first.Rounds[0].TieBreak
+	if record == nil || record.Rule != TieBreakRandom || record.Seed != 42 {
+		t.Fatalf("first round tie break = %+v, want a random draw with seed 42", record)
+	}
+	if !reflect.DeepEqual(record.Tied, []string{"Carol", "Dave"}) {
+		t.Errorf("tied = %v, want [Carol Dave]", record.Tied)
+	}
+	if !first.Tie() || !reflect.DeepEqual(first.Winners, []string{"Alice", "Bob"}) {
+		t.Errorf("winners = %v, want a tie between Alice and Bob", first.Winners)
+	}
+
+	// The same seed must always draw the same candidate
+	for i := 0; i < 10; i++ {
+		again, _ := Count(poll, ballots)
+		if !reflect.DeepEqual(again, first) {
+			t.Fatalf("Count() with the same seed gave %+v, then %+v", first, again)
+		}
+	}
+}
+
+func TestCountStaleDecision(t *testing.T) {
+	poll := Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob", "Carol"}, TieBreak: TieBreakCreator, Decisions: []string{"Alice"}}
+	ballots := ranked(concat(repeat(2, "Alice"), repeat(1, "Bob"), repeat(1, "Carol"))...)
+	result, err := Count(poll, ballots)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	// The decision is from before the tie changed, so a new one is needed
+	if want := []string{"Bob", "Carol"}; !reflect.DeepEqual(result.Pending, want) {
+		t.Errorf("Pending = %v, want %v", result.Pending, want)
+	}
+
+	// A decision made after it is used
+	poll.Decisions = append(poll.Decisions, "Carol")
+	result, err = Count(poll, ballots)
+	if err != nil || result.Pending != nil || result.Rounds[0].Eliminated != "Carol" {
+		t.Errorf("with a new decision, Count() = %+v, %v", result, err)
+	}
+}
+
+func TestCountUnknownMethod(t *testing.T) {
+	if _, err := Count(Poll{Method: "sortition"}, nil); err == nil {
+		t.Error("Count() with an unknown method should fail")
+	}
+}
+
+func TestRankedBallot(t *testing.T) {
+	tests := []struct {
+		name  string
+		ranks map[string]int
+		want  []string
+	}{
+		{"empty", map[string]int{}, []string{}},
+		{"in order", map[string]int{"Alice": 1, "Bob": 2, "Carol": 3}, []string{"Alice", "Bob", "Carol"}},
+		{"gaps are skipped", map[string]int{"Alice": 5, "Bob": 1, "Carol": 2}, []string{"Bob", "Carol", "Alice"}},
+		{"unranked choices are ignored", map[string]int{"Alice": 0, "Bob": -1, "Carol": 1}, []string{"Carol"}},
+		{"stops before a shared rank", map[string]int{"Alice": 1, "Bob": 2, "Carol": 2, "Dave": 3}, []string{"Alice"}},
+		{"shared first rank is exhausted", map[string]int{"Alice": 1, "Bob": 1}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RankedBallot(tt.ranks).Ranking; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RankedBallot(%v) = %v, want %v", tt.ranks, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountSchulze(t *testing.T) {
+	tests := []struct {
+		name            string
+		poll            Poll
+		ballots         []Ballot
+		ranking         [][]string
+		winners         []string
+		condorcetWinner string
+		paths           map[[2]string]int
+	}{
+		{
+			name:    "no votes",
+			poll:    Poll{Method: Schulze, Options: []string{"Alice", "Bob"}},
+			ranking: [][]string{{"Alice", "Bob"}},
+		},
+		{
+			// The example from Schulze's paper, with no Condorcet winner
+			name: "cycle",
+			poll: Poll{Method: Schulze, Options: []string{"A", "B", "C", "D", "E"}},
+			ballots: ranked(concat(
+				repeat(5, "A", "C", "B", "E", "D"),
+				repeat(5, "A", "D", "E", "C", "B"),
+				repeat(8, "B", "E", "D", "A", "C"),
+				repeat(3, "C", "A", "B", "E", "D"),
+				repeat(7, "C", "A", "E", "B", "D"),
+				repeat(2, "C", "B", "A", "D", "E"),
+				repeat(7, "D", "C", "E", "B", "A"),
+				repeat(8, "E", "B", "A", "D", "C"),
+			)...),
+			ranking: [][]string{{"E"}, {"A"}, {"C"}, {"B"}, {"D"}},
+			winners: []string{"E"},
+			paths: map[[2]string]int{
+				{"A", "B"}: 28, {"A", "E"}: 24, {"E", "A"}: 25,
+				{"B", "D"}: 33, {"D", "B"}: 28, {"C", "D"}: 29,
+			},
+		},
+		{
+			// Instant runoff eliminates Bob first, but Bob beats everyone head to head
+			name: "condorcet winner missed by instant runoff",
+			poll: Poll{Method: Schulze, Options: []string{"Alice", "Bob", "Carol"}},
+			ballots: ranked(concat(
+				repeat(8, "Alice", "Bob", "Carol"),
+				repeat(7, "Carol", "Bob", "Alice"),
+				repeat(3, "Bob", "Alice", "Carol"),
+				repeat(2, "Bob", "Carol", "Alice"),
+			)...),
+			ranking:         [][]string{{"Bob"}, {"Alice"}, {"Carol"}},
+			winners:         []string{"Bob"},
+			condorcetWinner: "Bob",
+		},
+		{
+			name: "unranked write-in loses to ranked choices",
+			poll: Poll{Method: Schulze, Options: []string{"Alice", "Bob"}},
+			ballots: ranked(concat(
+				repeat(2, "Zed"),
+				repeat(3, "Alice"),
+			)...),
+			ranking:         [][]string{{"Alice"}, {"Zed"}, {"Bob"}},
+			winners:         []string{"Alice"},
+			condorcetWinner: "Alice",
+		},
+		{
+			name:    "tie",
+			poll:    Poll{Method: Schulze, Options: []string{"Alice", "Bob"}},
+			ballots: ranked(concat(repeat(2, "Alice", "Bob"), repeat(2, "Bob", "Alice"))...),
+			ranking: [][]string{{"Alice", "Bob"}},
+			winners: []string{"Alice", "Bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Condorcet.Ranking, tt.ranking) {
+				t.Errorf("ranking = %v, want %v", got.Condorcet.Ranking, tt.ranking)
+			}
+			if !reflect.DeepEqual(got.Winners, tt.winners) {
+				t.Errorf("winners = %v, want %v", got.Winners, tt.winners)
+			}
+			if got.Condorcet.CondorcetWinner != tt.condorcetWinner {
+				t.Errorf("Condorcet winner = %q, want %q", got.Condorcet.CondorcetWinner, tt.condorcetWinner)
+			}
+			for pair, want := range tt.paths {
+				if path := got.Condorcet.Paths[pair[0]][pair[1]]; path != want {
+					t.Errorf("strongest path %s to %s = %d, want %d", pair[0], pair[1], path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountSTV(t *testing.T) {
+	tests := []struct {
+		name    string
+		poll    Poll
+		ballots []Ballot
+		quota   float64
+		winners []string
+		rounds  []STVRound
+	}{
+		{
+			name:   "no votes",
+			poll:   Poll{Method: STV, Options: []string{"Alice", "Bob", "Carol"}, Seats: 2},
+			quota:  1,
+			rounds: []STVRound{{Votes: map[string]float64{"Alice": 0, "Bob": 0, "Carol": 0}}},
+		},
+		{
+			name:    "fewer candidates than seats",
+			poll:    Poll{Method: STV, Options: []string{"Alice", "Bob"}, Seats: 3},
+			ballots: ranked(concat(repeat(2, "Alice"), repeat(1, "Bob"))...),
+			quota:   1,
+			winners: []string{"Alice", "Bob"},
+			rounds: []STVRound{
+				{Votes: map[string]float64{"Alice": 2, "Bob": 1}, Elected: []string{"Alice", "Bob"}},
+			},
+		},
+		{
+			// The food election from the Wikipedia article on STV
+			name: "surplus transfers and eliminations",
+			poll: Poll{Method: STV, Options: []string{"Oranges", "Pears", "Chocolate", "Strawberries", "Sweets"}, Seats: 3},
+			ballots: ranked(concat(
+				repeat(4, "Oranges"),
+				repeat(2, "Pears", "Oranges"),
+				repeat(8, "Chocolate", "Strawberries"),
+				repeat(4, "Chocolate", "Sweets"),
+				repeat(1, "Strawberries"),
+				repeat(1, "Sweets"),
+			)...),
+			quota:   6,
+			winners: []string{"Chocolate", "Oranges", "Strawberries"},
+			rounds: []STVRound{
+				{
+					Votes:         map[string]float64{"Oranges": 4, "Pears": 2, "Chocolate": 12, "Strawberries": 1, "Sweets": 1},
+					Elected:       []string{"Chocolate"},
+					Surplus:       "Chocolate",
+					TransferValue: 0.5,
+					Transfers:     map[string]float64{"Strawberries": 4, "Sweets": 2},
+				},
+				{
+					Votes:      map[string]float64{"Oranges": 4, "Pears": 2, "Chocolate": 6, "Strawberries": 5, "Sweets": 3},
+					Eliminated: "Pears",
+					Transfers:  map[string]float64{"Oranges": 2},
+				},
+				{
+					Votes:              map[string]float64{"Oranges": 6, "Chocolate": 6, "Strawberries": 5, "Sweets": 3},
+					Elected:            []string{"Oranges"},
+					Eliminated:         "Sweets",
+					Transfers:          map[string]float64{},
+					ExhaustedTransfers: 3,
+				},
+				{
+					Votes:     map[string]float64{"Oranges": 6, "Chocolate": 6, "Strawberries": 5},
+					Exhausted: 3,
+					Elected:   []string{"Strawberries"},
+				},
+			},
+		},
+		{
+			name: "single seat is instant runoff",
+			poll: Poll{Method: STV, Options: []string{"Alice", "Bob", "Carol"}, Seats: 1},
+			ballots: ranked(concat(
+				repeat(4, "Alice"),
+				repeat(3, "Bob", "Alice"),
+				repeat(5, "Carol"),
+			)...),
+			quota:   7,
+			winners: []string{"Alice"},
+			rounds: []STVRound{
+				{
+					Votes:      map[string]float64{"Alice": 4, "Bob": 3, "Carol": 5},
+					Eliminated: "Bob",
+					Transfers:  map[string]float64{"Alice": 3},
+				},
+				{
+					Votes:   map[string]float64{"Alice": 7, "Carol": 5},
+					Elected: []string{"Alice"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if got.STV.Quota != tt.quota {
+				t.Errorf("quota = %v, want %v", got.STV.Quota, tt.quota)
+			}
+			if !reflect.DeepEqual(got.Winners, tt.winners) {
+				t.Errorf("winners = %v, want %v", got.Winners, tt.winners)
+			}
+			if !reflect.DeepEqual(got.STV.Rounds, tt.rounds) {
+				t.Errorf("rounds = %+v, want %+v", got.STV.Rounds, tt.rounds)
+			}
+		})
+	}
+}
+
+func approved(choices ...[]string) []Ballot {
+	ballots := make([]Ballot, len(choices))
+	for i, c := range choices {
+		ballots[i] = Ballot{Approved: c}
+	}
+	return ballots
+}
+
+func TestCountApproval(t *testing.T) {
+	tests := []struct {
+		name    string
+		poll    Poll
+		ballots []Ballot
+		want    *Result
+	}{
+		{
+			name: "no votes",
+			poll: Poll{Method: Approval, Options: []string{"Monday", "Tuesday"}},
+			want: &Result{
+				Method:   Approval,
+				Rounds:   []Round{{Tallies: map[string]int{"Monday": 0, "Tuesday": 0}}},
+				Approval: &ApprovalCount{Percentages: map[string]float64{"Monday": 0, "Tuesday": 0}},
+			},
+		},
+		{
+			name: "most approvals wins",
+			poll: Poll{Method: Approval, Options: []string{"Monday", "Tuesday", "Friday"}},
+			ballots: approved(
+				[]string{"Monday", "Tuesday"},
+				[]string{"Tuesday"},
+				[]string{"Tuesday", "Friday"},
+				[]string{"Monday"},
+			),
+			want: &Result{
+				Method:   Approval,
+				Rounds:   []Round{{Tallies: map[string]int{"Monday": 2, "Tuesday": 3, "Friday": 1}}},
+				Winners:  []string{"Tuesday"},
+				Approval: &ApprovalCount{Turnout: 4, Percentages: map[string]float64{"Monday": 50, "Tuesday": 75, "Friday": 25}},
+			},
+		},
+		{
+			name: "blank ballots and write-ins",
+			poll: Poll{Method: Approval, Options: []string{"Monday", "Tuesday"}},
+			ballots: approved(
+				[]string{"Monday", "Sunday"},
+				[]string{"Sunday", "Sunday"},
+				nil,
+				[]string{"Tuesday"},
+			),
+			want: &Result{
+				Method:   Approval,
+				Rounds:   []Round{{Tallies: map[string]int{"Monday": 1, "Tuesday": 1, "Sunday": 2}, Exhausted: 1}},
+				Winners:  []string{"Sunday"},
+				Approval: &ApprovalCount{Turnout: 4, Percentages: map[string]float64{"Monday": 25, "Tuesday": 25, "Sunday": 50}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Count() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func scored(scores ...map[string]int) []Ballot {
+	ballots := make([]Ballot, len(scores))
+	for i, s := range scores {
+		ballots[i] = Ballot{Scores: s}
+	}
+	return ballots
+}
+
+func TestCountScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		poll    Poll
+		ballots []Ballot
+		want    *Result
+	}{
+		{
+			name: "no votes",
+			poll: Poll{Method: STAR, Options: []string{"Alice", "Bob"}, MaxScore: 5},
+			want: &Result{
+				Method: STAR,
+				Rounds: []Round{{Tallies: map[string]int{"Alice": 0, "Bob": 0}}},
+				Score: &ScoreCount{
+					MaxScore: 5,
+					Totals:   map[string]int{"Alice": 0, "Bob": 0},
+					Averages: map[string]float64{"Alice": 0, "Bob": 0},
+				},
+			},
+		},
+		{
+			name: "highest total wins",
+			poll: Poll{Method: Score, Options: []string{"Alice", "Bob", "Carol"}, MaxScore: 5},
+			ballots: scored(
+				map[string]int{"Alice": 5, "Bob": 4},
+				map[string]int{"Alice": 0, "Bob": 4, "Carol": 5},
+				map[string]int{"Carol": 2, "Dave": 3},
+			),
+			want: &Result{
+				Method:  Score,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 5, "Bob": 8, "Carol": 7, "Dave": 3}}},
+				Winners: []string{"Bob"},
+				Score: &ScoreCount{
+					MaxScore: 5,
+					Turnout:  3,
+					Totals:   map[string]int{"Alice": 5, "Bob": 8, "Carol": 7, "Dave": 3},
+					Averages: map[string]float64{"Alice": 5.0 / 3, "Bob": 8.0 / 3, "Carol": 7.0 / 3, "Dave": 1},
+				},
+			},
+		},
+		{
+			// Bob has the highest total, but more voters prefer Carol
+			name: "runoff overturns the highest total",
+			poll: Poll{Method: STAR, Options: []string{"Alice", "Bob", "Carol"}, MaxScore: 5},
+			ballots: scored(
+				map[string]int{"Bob": 5, "Carol": 0},
+				map[string]int{"Bob": 3, "Carol": 4},
+				map[string]int{"Bob": 3, "Carol": 4, "Alice": 1},
+			),
+			want: &Result{
+				Method:  STAR,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 1, "Bob": 11, "Carol": 8}}},
+				Winners: []string{"Carol"},
+				Score: &ScoreCount{
+					MaxScore: 5,
+					Turnout:  3,
+					Totals:   map[string]int{"Alice": 1, "Bob": 11, "Carol": 8},
+					Averages: map[string]float64{"Alice": 1.0 / 3, "Bob": 11.0 / 3, "Carol": 8.0 / 3},
+					Runoff: &Runoff{
+						Finalists:   []string{"Bob", "Carol"},
+						Preferences: map[string]int{"Bob": 1, "Carol": 2},
+					},
+				},
+			},
+		},
+		{
+			name: "tied runoff goes to the highest total",
+			poll: Poll{Method: STAR, Options: []string{"Alice", "Bob"}, MaxScore: 3},
+			ballots: scored(
+				map[string]int{"Alice": 3, "Bob": 0},
+				map[string]int{"Alice": 1, "Bob": 2},
+				map[string]int{"Alice": 2, "Bob": 2},
+			),
+			want: &Result{
+				Method:  STAR,
+				Rounds:  []Round{{Tallies: map[string]int{"Alice": 6, "Bob": 4}}},
+				Winners: []string{"Alice"},
+				Score: &ScoreCount{
+					MaxScore: 3,
+					Turnout:  3,
+					Totals:   map[string]int{"Alice": 6, "Bob": 4},
+					Averages: map[string]float64{"Alice": 2, "Bob": 4.0 / 3},
+					Runoff: &Runoff{
+						Finalists:    []string{"Alice", "Bob"},
+						Preferences:  map[string]int{"Alice": 1, "Bob": 1},
+						NoPreference: 1,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Count() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountSTARFinalistTie(t *testing.T) {
+	poll := Poll{Method: STAR, Options: []string{"Alice", "Bob", "Carol"}, MaxScore: 5, Seed: 7}
+	ballots := scored(
+		map[string]int{"Alice": 5, "Bob": 2, "Carol": 2},
+		map[string]int{"Alice": 4, "Bob": 3, "Carol": 3},
+	)
+
+	first, err := Count(poll, ballots)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	runoff := first.Score.Runoff
+	if len(runoff.Finalists) != 2 || runoff.Finalists[0] != "Alice" {
+		t.Fatalf("finalists = %v, want Alice and one of Bob or Carol", runoff.Finalists)
+	}
+	want := &TieBreakRecord{Tied: []string{"Bob", "Carol"}, Rule: TieBreakRandom, Seed: 7}
+	if !reflect.DeepEqual(runoff.TieBreak, want) {
+		t.Errorf("tie break = %+v, want %+v", runoff.TieBreak, want)
+	}
+
+	// The same seed always draws the same finalist
+	second, _ := Count(poll, ballots)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("counts differ with the same seed: %+v and %+v", first, second)
+	}
+}
+
+func TestCountOutcome(t *testing.T) {
+	motion := []string{"Pass", "Fail", "Abstain"}
+	tests := []struct {
+		name    string
+		poll    Poll
+		ballots []Ballot
+		want    *Outcome
+	}{
+		{
+			name:    "majority passes",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority},
+			ballots: ranked(concat(repeat(3, "Pass"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdMajority, Turnout: 5, Counted: 5, Option: "Pass", Votes: 3, Needed: 3},
+		},
+		{
+			name:    "two thirds ignores abstentions",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdTwoThirds},
+			ballots: ranked(concat(repeat(6, "Pass"), repeat(3, "Fail"), repeat(3, "Abstain"))...),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdTwoThirds, Turnout: 12, Abstained: 3, Counted: 9, Option: "Pass", Votes: 6, Needed: 6},
+		},
+		{
+			name:    "counted abstentions act as votes against",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdTwoThirds, CountAbstain: true},
+			ballots: ranked(concat(repeat(6, "Pass"), repeat(3, "Fail"), repeat(3, "Abstain"))...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdTwoThirds, CountAbstain: true, Turnout: 12, Abstained: 3, Counted: 12, Option: "Pass", Votes: 6, Needed: 8},
+		},
+		{
+			name:    "three quarters",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdThreeQuarters},
+			ballots: ranked(concat(repeat(6, "Pass"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdThreeQuarters, Turnout: 8, Counted: 8, Option: "Pass", Votes: 6, Needed: 6},
+		},
+		{
+			name:    "unanimous fails with one dissent",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdUnanimous},
+			ballots: ranked(concat(repeat(6, "Pass"), repeat(1, "Fail"), repeat(2, "Abstain"))...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdUnanimous, Turnout: 9, Abstained: 2, Counted: 7, Option: "Pass", Votes: 6, Needed: 7},
+		},
+		{
+			name:    "a tie fails",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority},
+			ballots: ranked(concat(repeat(2, "Pass"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdMajority, Turnout: 4, Counted: 4, Option: "Pass", Votes: 2, Needed: 3},
+		},
+		{
+			name:    "Fail leading fails",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdTwoThirds},
+			ballots: ranked(concat(repeat(2, "Pass"), repeat(8, "Fail"))...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdTwoThirds, Turnout: 10, Counted: 10, Option: "Pass", Votes: 2, Needed: 7},
+		},
+		{
+			name:    "Abstain leading is measured on Pass",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority, CountAbstain: true},
+			ballots: ranked(concat(repeat(3, "Pass"), repeat(1, "Fail"), repeat(5, "Abstain"))...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdMajority, CountAbstain: true, Turnout: 9, Abstained: 5, Counted: 9, Option: "Pass", Votes: 3, Needed: 5},
+		},
+		{
+			name:    "only abstentions fails",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority},
+			ballots: ranked(repeat(2, "Abstain")...),
+			want:    &Outcome{Status: StatusFailed, Threshold: ThresholdMajority, Turnout: 2, Abstained: 2, Option: "Pass", Needed: 1},
+		},
+		{
+			name:    "a named motion",
+			poll:    Poll{Method: Plurality, Options: []string{"Fail", "Conditional", "Abstain"}, Threshold: ThresholdMajority, Motion: "Conditional"},
+			ballots: ranked(concat(repeat(3, "Conditional"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdMajority, Turnout: 5, Counted: 5, Option: "Conditional", Votes: 3, Needed: 3},
+		},
+		{
+			name:    "no motion is undecided",
+			poll:    Poll{Method: Plurality, Options: []string{"Fail", "Conditional", "Abstain"}, Threshold: ThresholdMajority},
+			ballots: ranked(concat(repeat(3, "Conditional"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusUndecided, Threshold: ThresholdMajority, Turnout: 5, Counted: 5},
+		},
+		{
+			name:    "no quorum",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority, Quorum: 10},
+			ballots: ranked(concat(repeat(8, "Pass"), repeat(1, "Abstain"))...),
+			want:    &Outcome{Status: StatusNoQuorum, Threshold: ThresholdMajority, Quorum: 10, Turnout: 9, Abstained: 1, Counted: 8, Option: "Pass", Votes: 8, Needed: 5},
+		},
+		{
+			name:    "no quorum of the roll",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority, QuorumPercent: 50, Roll: 25},
+			ballots: ranked(concat(repeat(10, "Pass"), repeat(2, "Fail"))...),
+			want:    &Outcome{Status: StatusNoQuorum, Threshold: ThresholdMajority, Quorum: 13, QuorumPercent: 50, Roll: 25, Turnout: 12, Counted: 12, Option: "Pass", Votes: 10, Needed: 7},
+		},
+		{
+			name:    "quorum of the roll",
+			poll:    Poll{Method: Plurality, Options: motion, Threshold: ThresholdMajority, QuorumPercent: 50, Roll: 25},
+			ballots: ranked(concat(repeat(10, "Pass"), repeat(3, "Fail"))...),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdMajority, Quorum: 13, QuorumPercent: 50, Roll: 25, Turnout: 13, Counted: 13, Option: "Pass", Votes: 10, Needed: 7},
+		},
+		{
+			name:    "the larger quorum applies",
+			poll:    Poll{Method: Plurality, Options: motion, Quorum: 15, QuorumPercent: 50, Roll: 25},
+			ballots: ranked(repeat(14, "Pass")...),
+			want:    &Outcome{Status: StatusNoQuorum, Quorum: 15, Turnout: 14, Counted: 14},
+		},
+		{
+			name:    "quorum of the roll without a roll",
+			poll:    Poll{Method: Plurality, Options: motion, QuorumPercent: 50},
+			ballots: ranked(repeat(1, "Pass")...),
+			want:    &Outcome{Status: StatusPassed, Turnout: 1, Counted: 1},
+		},
+		{
+			name:    "approval is measured against voters",
+			poll:    Poll{Method: Approval, Options: []string{"Monday", "Tuesday"}, Threshold: ThresholdTwoThirds, Motion: "Monday"},
+			ballots: approved([]string{"Monday", "Tuesday"}, []string{"Monday"}, []string{"Tuesday"}),
+			want:    &Outcome{Status: StatusPassed, Threshold: ThresholdTwoThirds, Turnout: 3, Counted: 3, Option: "Monday", Votes: 2, Needed: 2},
+		},
+		{
+			name:    "quorum only for other methods",
+			poll:    Poll{Method: InstantRunoff, Options: []string{"Alice", "Bob"}, Threshold: ThresholdTwoThirds, Quorum: 3},
+			ballots: ranked(concat(repeat(2, "Alice"), repeat(1, "Bob"))...),
+			want:    &Outcome{Status: StatusPassed, Quorum: 3, Turnout: 3, Counted: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(tt.poll, tt.ballots)
+			if err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Outcome, tt.want) {
+				t.Errorf("outcome = %+v, want %+v", got.Outcome, tt.want)
+			}
+		})
+	}
+}
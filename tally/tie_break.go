@@ -0,0 +1,88 @@
+package tally
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// tieBreaker picks which of several candidates tied for last is eliminated
+type tieBreaker struct {
+	poll Poll
+	rng  *rand.Rand
+	// decided counts how many of poll.Decisions have been used
+	decided int
+}
+
+// choose returns the candidate to eliminate from tied, which is sorted, and a
+// record of how it was chosen. The record is nil if the tie is waiting on a
+// decision from the creator. A decision that isn't one of the tied
+// candidates was made before ballots changed the tie, so it is passed over
+// and the tie waits on a new one.
+func (breaker *tieBreaker) choose(tied []string, history []map[string]float64) (string, *TieBreakRecord, error) {
+	record := &TieBreakRecord{Tied: tied, Rule: breaker.poll.TieBreak}
+	// The candidates a random draw picks from
+	drawn := tied
+
+	switch breaker.poll.TieBreak {
+	case TieBreakCreator:
+		for breaker.decided < len(breaker.poll.Decisions) {
+			decision := breaker.poll.Decisions[breaker.decided]
+			breaker.decided++
+			if containsString(tied, decision) {
+				return decision, record, nil
+			}
+		}
+		return "", nil, nil
+
+	case TieBreakPreviousRound, "":
+		record.Rule = TieBreakPreviousRound
+		// Walk back through the earlier rounds, keeping only the candidates
+		// that had the fewest votes, until one is left on their own
+		for i := len(history) - 1; i >= 0; i-- {
+			votes := make(map[string]float64)
+			for _, candidate := range drawn {
+				votes[candidate] = history[i][candidate]
+			}
+			drawn = fewest(votes)
+			if len(drawn) == 1 {
+				record.Round = i + 1
+				return drawn[0], record, nil
+			}
+		}
+		record.Rule = TieBreakRandom
+		fallthrough
+
+	case TieBreakRandom:
+		record.Seed = breaker.poll.Seed
+		return drawn[breaker.rng.Intn(len(drawn))], record, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown tie break rule %q", breaker.poll.TieBreak)
+}
+
+// skip passes over the creator's decisions about candidates that have just
+// been eliminated together for having no votes, which polls counted before
+// that asked for one at a time
+func (breaker *tieBreaker) skip(eliminated []string) {
+	if breaker.poll.TieBreak != TieBreakCreator {
+		return
+	}
+	for breaker.decided < len(breaker.poll.Decisions) && containsString(eliminated, breaker.poll.Decisions[breaker.decided]) {
+		breaker.decided++
+	}
+}
+
+// fewest returns the candidates with the fewest votes, sorted by name
+func fewest(votes map[string]float64) []string {
+	var candidates []string
+	for candidate, count := range votes {
+		if len(candidates) == 0 || count < votes[candidates[0]] {
+			candidates = []string{candidate}
+		} else if count == votes[candidates[0]] {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
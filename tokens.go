@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/database"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenPrefix starts every API token secret, so they are easy to spot
+const tokenPrefix = "vote_"
+
+// tokenLifetime is how long a token works for after it is made
+const tokenLifetime = 30 * 24 * time.Hour
+
+// apiAuth logs in an API request with either a personal API token, sent as
+// "Authorization: Bearer <token>", or the site's session cookie. A token must
+// have scope. Either way the claims are set under "cshauth" like
+// auth.AuthWrapper does, and a token is also set under "apiToken".
+func apiAuth(auth authenticator, scope string, page gin.HandlerFunc) gin.HandlerFunc {
+	session := auth.AuthWrapper(page)
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			// The session login redirects to the login page, which is no use
+			// to a script
+			if cookie, err := c.Cookie(cshAuth.CookieName); err != nil || cookie == "" {
+				apiError(c, 401, "Log in, or send an API token as a bearer token.")
+				return
+			}
+			session(c)
+			return
+		}
+
+		secret, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			apiError(c, 401, "The Authorization header must be a bearer token.")
+			return
+		}
+		token, err := database.GetToken(c, database.HashToken(strings.TrimSpace(secret)))
+		if errors.Is(err, database.ErrTokenNotFound) || (err == nil && token.Revoked) {
+			apiError(c, 401, "This token doesn't exist or has been revoked.")
+			return
+		}
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		if token.Expired(time.Now()) {
+			apiError(c, 401, "This token has expired, make a new one at /tokens.")
+			return
+		}
+		if !token.HasScope(scope) {
+			apiError(c, 403, fmt.Sprintf("This token doesn't have the %s scope.", scope))
+			return
+		}
+
+		claims, err := tokenClaims(c, token)
+		if errors.Is(err, errNotMember) {
+			apiError(c, 401, "The user this token belongs to is no longer in the directory.")
+			return
+		}
+		if err != nil {
+			apiError(c, 500, err.Error())
+			return
+		}
+		c.Set(cshAuth.AuthKey, claims)
+		c.Set("apiToken", token)
+		page(c)
+	}
+}
+
+// errNotMember is returned by tokenClaims when the token's user has left the
+// directory
+var errNotMember = errors.New("user is not in the directory")
+
+// tokenClaims is who the token acts as. With a directory the user's name and
+// groups are looked up on every request, so a token loses anything its user
+// has lost since it was made. Without one they are what the user had when
+// the token was made.
+func tokenClaims(ctx context.Context, token *database.Token) (cshAuth.CSHClaims, error) {
+	claims := cshAuth.CSHClaims{
+		UserInfo: cshAuth.CSHUserInfo{
+			Username: token.UserId,
+			FullName: token.FullName,
+			Groups:   token.Groups,
+		},
+	}
+	if members == nil {
+		return claims, nil
+	}
+
+	all, err := members.Members(ctx)
+	if err != nil {
+		return claims, err
+	}
+	for _, member := range all {
+		if member.Username == token.UserId {
+			claims.UserInfo.FullName = member.Name
+			claims.UserInfo.Groups = member.Groups
+			return claims, nil
+		}
+	}
+	return claims, errNotMember
+}
+
+// requestToken is the API token the request was made with, or nil
+func requestToken(c *gin.Context) *database.Token {
+	if token, ok := c.Get("apiToken"); ok {
+		return token.(*database.Token)
+	}
+	return nil
+}
+
+// registerTokens serves the page users make and revoke their API tokens on.
+// Tokens can only be managed when logged in to the site, never with a token.
+func registerTokens(r *gin.Engine, auth authenticator) {
+	r.GET("/tokens", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		renderTokens(c, claims, 200, "", "")
+	}))
+
+	r.POST("/tokens", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			renderTokens(c, claims, 400, "", "Give your token a name, so you know what it's for.")
+			return
+		}
+		var scopes []string
+		for _, scope := range c.PostFormArray("scope") {
+			if !containsString(api.Scopes, scope) {
+				renderTokens(c, claims, 400, "", fmt.Sprintf("Unknown scope %q", scope))
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+		if len(scopes) == 0 {
+			renderTokens(c, claims, 400, "", "Choose at least one thing the token can do.")
+			return
+		}
+
+		bytes := make([]byte, 32)
+		if _, err := rand.Read(bytes); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		secret := tokenPrefix + hex.EncodeToString(bytes)
+		now := time.Now()
+
+		_, err := database.CreateToken(c, &database.Token{
+			Id:        "",
+			UserId:    claims.UserInfo.Username,
+			FullName:  claims.UserInfo.FullName,
+			Groups:    claims.UserInfo.Groups,
+			Name:      name,
+			Hash:      database.HashToken(secret),
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: now.Add(tokenLifetime),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The secret is only ever shown this once
+		renderTokens(c, claims, 200, secret, "")
+	}))
+
+	r.POST("/tokens/:id/revoke", auth.AuthWrapper(func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+
+		err := database.RevokeToken(c, c.Param("id"), claims.UserInfo.Username)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Redirect(302, "/tokens")
+	}))
+}
+
+// renderTokens shows the user's tokens, with the secret of one they just
+// made or a problem with the one they tried to make
+func renderTokens(c *gin.Context, claims cshAuth.CSHClaims, status int, secret, problem string) {
+	tokens, err := database.GetTokens(c, claims.UserInfo.Username)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	c.HTML(status, "tokens.tmpl", gin.H{
+		"Tokens":   tokens,
+		"Scopes":   api.Scopes,
+		"Secret":   secret,
+		"Error":    problem,
+		"Now":      time.Now(),
+		"Username": claims.UserInfo.Username,
+		"FullName": claims.UserInfo.FullName,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	cshAuth "github.com/computersciencehouse/csh-auth"
+	"github.com/computersciencehouse/vote/api"
+	"github.com/computersciencehouse/vote/database"
+	"github.com/computersciencehouse/vote/directory"
+	"github.com/gin-gonic/gin"
+)
+
+// TestTokenClaims checks that a token acts with its user's current groups,
+// and not at all once it has expired or they have left the directory
+func TestTokenClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	database.SetStore(database.NewMemoryStore())
+	members = directory.NewFile("directory/testdata/members.json")
+	defer func() { members = nil }()
+
+	r := gin.New()
+	r.GET("/whoami", apiAuth(devAuth{}, api.ScopePollsRead, func(c *gin.Context) {
+		cl, _ := c.Get("cshauth")
+		claims := cl.(cshAuth.CSHClaims)
+		c.JSON(200, claims.UserInfo)
+	}))
+	whoami := func(secret string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/whoami", nil)
+		request.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+
+	now := time.Now()
+	tokens := map[string]*database.Token{
+		"current": {UserId: "alice", Groups: []string{"member"}, ExpiresAt: now.Add(time.Hour)},
+		"expired": {UserId: "alice", Groups: []string{"member"}, ExpiresAt: now.Add(-time.Hour)},
+		"legacy":  {UserId: "alice", Groups: []string{"member"}},
+		"left":    {UserId: "dave", Groups: []string{"member", "active"}, ExpiresAt: now.Add(time.Hour)},
+	}
+	for secret, token := range tokens {
+		token.Hash = database.HashToken(secret)
+		token.Scopes = []string{api.ScopePollsRead}
+		token.CreatedAt = now
+		if _, err := database.CreateToken(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := whoami("current")
+	var info cshAuth.CSHUserInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); w.Code != 200 || err != nil {
+		t.Fatalf("current token got %d %s", w.Code, w.Body.String())
+	}
+	want := cshAuth.CSHUserInfo{Username: "alice", FullName: "Alice Anderson", Groups: []string{"member", "active", "eboard"}}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("current token acted as %+v, want %+v", info, want)
+	}
+
+	for _, secret := range []string{"expired", "legacy", "left"} {
+		if w := whoami(secret); w.Code != 401 {
+			t.Errorf("%s token got %d, want 401", secret, w.Code)
+		}
+	}
+}
+
+// TestRevealScope checks that hiding a poll's results and revealing them
+// again need their own scopes
+func TestRevealScope(t *testing.T) {
+	r, _ := newTestServer(t)
+	id := createPoll(t, &database.Poll{
+		VoteType: database.POLL_TYPE_SIMPLE,
+		Options:  []string{"Pass", "Fail", "Abstain"},
+	})
+	now := time.Now()
+	for secret, scope := range map[string]string{"hide": api.ScopePollsHide, "reveal": api.ScopePollsReveal} {
+		token := &database.Token{UserId: "chair", Groups: []string{"active"}, Scopes: []string{scope}, Hash: database.HashToken(secret), CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		if _, err := database.CreateToken(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := func(secret, action string) int {
+		request := httptest.NewRequest("POST", "/api/v1/polls/"+id+"/"+action, nil)
+		request.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	for _, step := range []struct {
+		secret, action string
+		status         int
+	}{
+		{"reveal", "hide", 403},
+		{"hide", "hide", 200},
+		{"hide", "reveal", 403},
+		{"reveal", "reveal", 200},
+	} {
+		if got := post(step.secret, step.action); got != step.status {
+			t.Errorf("%s with the %s token got %d, want %d", step.action, step.secret, got, step.status)
+		}
+	}
+}